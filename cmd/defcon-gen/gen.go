@@ -0,0 +1,1036 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kjansson/defcon"
+)
+
+// defconPath is the import path of the defcon package used by generated code
+const defconPath = "github.com/kjansson/defcon"
+
+// annotationKeys are the annotations understood by defcon, in the order of the defcon package
+var annotationKeys = []string{
+	"required", "default", "defaultfrom", "env", "requires", "excludes", "exactlyone", "atleastone", "atmostone",
+	"ltfield", "ltefield", "gtfield", "gtefield", "eqfield", "nefield", "musthave", "unique", "alwayshas",
+	"sep", "oneoftype", "mustmatch", "mustnotmatch", "validrange", "validate", "assert", "secret", "desc", "reload", "defcon", "errormsg",
+}
+
+// commonKeys are annotations that are valid on fields of any type, they are handled on the struct level or only document the field
+var commonKeys = []string{"requires", "secret", "desc", "reload", "defcon", "errormsg"}
+
+const (
+	requiredMsg = "field is marked as required but has no value"
+	envMsg      = "failed to set value from environment variable: %v"
+	rangeMsg    = "integer value is out of the specified range"
+)
+
+// generator writes the DefconCheck method of a config struct
+type generator struct {
+	pkg      *types.Package
+	typeName string
+	imports  map[string]string // Names of packages referenced by the generated code, keyed by import path
+	regexps  []string          // Regular expressions compiled into package level variables
+	body     *bytes.Buffer     // Statements of the code block currently being generated
+	n        int               // Counter for unique identifiers
+	scopes   []scope           // Structs enclosing the fields currently being generated, starting with the root struct, for resolving paths in "requires"
+	inline   bool              // True while generating the checks of an inline struct, its fields belong to the scope of the containing struct
+}
+
+// scope is a struct enclosing the fields currently being generated
+type scope struct {
+	expr string        // Addressable expression of the struct or pointer to it
+	path string        // Expression of the path of the struct from the root
+	st   *types.Struct // Type of the struct
+}
+
+// generate returns the formatted source of a file declaring the DefconCheck method of the named struct type
+func generate(pkg *types.Package, named *types.Named) ([]byte, error) {
+
+	if named.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("generic type %s is not supported", named.Obj().Name())
+	}
+
+	g := &generator{pkg: pkg, typeName: named.Obj().Name(), imports: map[string]string{}, body: &bytes.Buffer{}}
+	err := g.structChecks("c", `""`, named, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = g.requiresChecks("c", `""`, named, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by defcon-gen; DO NOT EDIT.\n\npackage %s\n\n", pkg.Name())
+
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if len(paths) > 0 {
+		// Standard library imports first, followed by other imports in a separate group
+		fmt.Fprintln(&out, "import (")
+		for _, std := range []bool{true, false} {
+			for _, path := range paths {
+				if isStd(path) != std {
+					continue
+				}
+				if name := g.imports[path]; name != path[strings.LastIndex(path, "/")+1:] {
+					fmt.Fprintf(&out, "%s %q\n", name, path)
+				} else {
+					fmt.Fprintf(&out, "%q\n", path)
+				}
+			}
+			fmt.Fprintln(&out)
+		}
+		fmt.Fprintln(&out, ")")
+	}
+
+	for i, pattern := range g.regexps {
+		fmt.Fprintf(&out, "\nvar %s = regexp.MustCompile(%s)\n", g.regexpName(i), quote(pattern))
+	}
+
+	fmt.Fprintf(&out, "\n// DefconCheck validates and alters the fields of %s according to their annotations, defcon.CheckStruct calls it instead of using reflection\n", g.typeName)
+	fmt.Fprintf(&out, "func (c *%s) DefconCheck() error {\n%sreturn nil\n}\n", g.typeName, g.body)
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %s", err)
+	}
+
+	return src, nil
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(g.body, format, args...)
+}
+
+// ident returns an identifier that is unique within the generated method
+func (g *generator) ident(prefix string) string {
+	g.n++
+	return prefix + strconv.Itoa(g.n)
+}
+
+// use records an import of the generated code and returns the package name to reference it by
+func (g *generator) use(path, name string) string {
+	g.imports[path] = name
+	return name
+}
+
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	return g.use(p.Path(), p.Name())
+}
+
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+func (g *generator) regexpName(i int) string {
+	return fmt.Sprintf("defcon%sRegexp%d", g.typeName, i+1)
+}
+
+// regexp returns the name of a package level variable holding the compiled regular expression
+func (g *generator) regexp(pattern string) (string, error) {
+	_, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("could not parse regular expression: %s", err)
+	}
+	g.use("regexp", "regexp")
+	g.regexps = append(g.regexps, pattern)
+	return g.regexpName(len(g.regexps) - 1), nil
+}
+
+// errorf returns an expression creating an error with a message known at generation time
+func (g *generator) errorf(format string, args ...any) string {
+	return fmt.Sprintf("%s.New(%s)", g.use("errors", "errors"), quote(fmt.Sprintf(format, args...)))
+}
+
+// block generates code with gen into a separate buffer and returns it
+func (g *generator) block(gen func() error) (string, error) {
+	outer := g.body
+	g.body = &bytes.Buffer{}
+	defer func() { g.body = outer }()
+	err := gen()
+	return g.body.String(), err
+}
+
+// hasMethod returns true if pointers to the type have a method with the given name, no parameters and the given results
+func (g *generator) hasMethod(t types.Type, name string, results ...types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), true, g.pkg, name)
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != len(results) {
+		return false
+	}
+	for i, result := range results {
+		if !types.Identical(sig.Results().At(i).Type(), result) {
+			return false
+		}
+	}
+	return true
+}
+
+// structChecks generates the checks of a struct, expr is an addressable expression or pointer to it and path an expression of its path from the root
+func (g *generator) structChecks(expr, path string, t types.Type, ancestors []types.Type) error {
+
+	for _, ancestor := range ancestors {
+		if types.Identical(ancestor, t) {
+			return fmt.Errorf("recursive type %s is not supported", t)
+		}
+	}
+	ancestors = append(ancestors, t)
+	st := t.Underlying().(*types.Struct)
+
+	// Enter the scope of the struct for paths in "requires", inline structs share the scope of the containing struct
+	if !g.inline {
+		g.scopes = append(g.scopes, scope{expr: expr, path: path, st: st})
+		defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+	}
+	g.inline = false
+
+	// Let the struct set its own defaults before any annotations are processed
+	if g.hasMethod(t, "SetDefaults") {
+		g.printf("%s.SetDefaults()\n", expr)
+	}
+
+	for i := 0; i < st.NumFields(); i++ {
+
+		f := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		fieldExpr := expr + "." + f.Name()
+		errMsg, hasErrMsg := tag.Lookup("errormsg")
+
+		// Fields tagged `defcon:"-"` are left untouched
+		if strings.TrimSpace(tag.Get("defcon")) == "-" {
+			continue
+		}
+
+		if f.Name() == "_" {
+			err := g.checkKeys(f, tag)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Fields of inline structs have the path of the containing struct
+		fieldPath := joinPath(path, f.Name())
+		inline, err := isInline(f, tag)
+		if err != nil {
+			return err
+		}
+		if inline {
+			fieldPath = path
+		}
+
+		checks, err := g.block(func() error {
+			g.inline = inline
+			return g.fieldChecks(f, fieldExpr, fieldPath, tag, ancestors)
+		})
+		g.inline = false
+		if err != nil {
+			return err
+		}
+		if checks == "" {
+			continue
+		}
+		if !f.Exported() && f.Pkg() != g.pkg {
+			return fmt.Errorf("field %s of type %s is unexported and can not be accessed by generated code", f.Name(), t)
+		}
+
+		// Use custom error message if provided in the annotations
+		if hasErrMsg {
+			g.printf("if err := func() error {\n%sreturn nil\n}(); err != nil {\nreturn %s\n}\n", checks, g.errorf("%s", errMsg))
+		} else {
+			g.printf("{\n%s}\n", checks)
+		}
+	}
+
+	// Let the struct validate itself once all fields are processed
+	if g.hasMethod(t, "Validate", types.Universe.Lookup("error").Type()) {
+		g.printf("if err := %s.Validate(); err != nil {\nreturn &%s.FieldError{Path: %s, Err: err}\n}\n", expr, g.use(defconPath, "defcon"), path)
+	}
+
+	return nil
+}
+
+// requiresChecks generates the checks of "requires" tags of a struct and its nested structs. They run once all fields have been processed,
+// so that referenced fields have their defaults and environment variables applied regardless of the order in which they are declared.
+func (g *generator) requiresChecks(expr, path string, t types.Type, inline bool) error {
+
+	st := t.Underlying().(*types.Struct)
+
+	// Enter the scope of the struct for paths in "requires", inline structs share the scope of the containing struct
+	if !inline {
+		g.scopes = append(g.scopes, scope{expr: expr, path: path, st: st})
+		defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+	}
+
+	for i := 0; i < st.NumFields(); i++ {
+
+		f := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		fieldExpr := expr + "." + f.Name()
+		if strings.TrimSpace(tag.Get("defcon")) == "-" || f.Name() == "_" {
+			continue
+		}
+
+		// Check that the fields required by the current field are set if the current field is set
+		requires := splitList(tag.Get("requires"))
+		if len(requires) > 0 {
+			errMsg, hasErrMsg := tag.Lookup("errormsg")
+			g.printf("if %s {\n", g.nonZero(fieldExpr, f.Type()))
+			for _, name := range requires {
+				// Fields of the same struct are looked up by name, other names and paths are resolved against the whole config
+				var cond, requiredPath string
+				if field, selector, found := lookupField(st, name); found && token.IsIdentifier(name) {
+					cond, requiredPath = g.setCond(expr+"."+selector, field), joinPath(path, name)
+				} else {
+					var err error
+					cond, requiredPath, err = g.requiredPath(name)
+					if err != nil {
+						return fmt.Errorf("field %s tagged as required by field %s: %s", name, f.Name(), err)
+					}
+				}
+				msg := fmt.Sprintf("%s.New(%s)", g.use("errors", "errors"), concat(`"field "`, joinPath(path, f.Name()), `" requires field "`, requiredPath, `" to be set"`))
+				if hasErrMsg {
+					msg = g.errorf("%s", errMsg)
+				}
+				if !token.IsIdentifier(cond) {
+					cond = "(" + cond + ")"
+				}
+				g.printf("if !%s {\nreturn %s\n}\n", cond, msg)
+			}
+			g.printf("}\n")
+		}
+
+		// Nested structs and slices of structs are descended into, their types have been validated by structChecks
+		fieldPath := joinPath(path, f.Name())
+		fieldInline, _ := isInline(f, tag)
+		if fieldInline {
+			fieldPath = path
+		}
+		var elem types.Type
+		switch u := f.Type().Underlying().(type) {
+		case *types.Struct:
+			if isOpaque(f.Type()) {
+				continue
+			}
+			err := g.requiresChecks(fieldExpr, fieldPath, f.Type(), fieldInline)
+			if err != nil {
+				return err
+			}
+		case *types.Slice:
+			elem = u.Elem()
+		case *types.Array:
+			elem = u.Elem()
+		}
+		if elem == nil {
+			continue
+		}
+		if _, ok := elem.Underlying().(*types.Struct); !ok {
+			continue
+		}
+
+		i := g.ident("i")
+		e := g.ident("e")
+		checks, err := g.block(func() error {
+			return g.requiresChecks(e, fmt.Sprintf(`%s[" + %s.Itoa(%s) + "]"`, fieldPath[:len(fieldPath)-1], g.use("strconv", "strconv"), i), elem, false)
+		})
+		if err != nil {
+			return err
+		}
+		if checks == "" {
+			continue
+		}
+		g.printf("for %s := range %s {\n", i, fieldExpr)
+		g.printf("if err := func(%s *%s) error {\n%sreturn nil\n}(&%s[%s]); err != nil {\nreturn err\n}\n}\n", e, g.typeString(elem), checks, fieldExpr, i)
+	}
+
+	return nil
+}
+
+// setCond returns a condition that is true if a field referenced by a "requires" annotation is set, i.e. not zero or provided by an environment variable
+func (g *generator) setCond(expr string, field taggedField) string {
+	cond := g.nonZero(expr, field.Type())
+	if env, found := field.tag.Lookup("env"); found {
+		cond = fmt.Sprintf("%s || func() bool { _, ok := %s.LookupEnv(%q); return ok }()", cond, g.use("os", "os"), strings.TrimSpace(env))
+	}
+	return cond
+}
+
+// requiredPath returns a condition that is true if the field at a path referenced by a "requires" annotation is set, and an expression of the path of the field.
+// Paths without leading dots, e.g. "Database.Host" or "Hostname", are absolute from the root struct. Paths starting with dots are relative, "." being the struct of the annotated field,
+// ".." its parent and so on, e.g. "..TLS.CertFile". Fields of inline structs are resolved as promoted fields.
+func (g *generator) requiredPath(path string) (string, string, error) {
+
+	// Count the leading dots to find the struct the path starts from
+	rest := strings.TrimLeft(path, ".")
+	base := g.scopes[0]
+	if dots := len(path) - len(rest); dots > 0 {
+		if dots > len(g.scopes) {
+			return "", "", fmt.Errorf("path %s goes above the root struct", path)
+		}
+		base = g.scopes[len(g.scopes)-dots]
+	}
+
+	expr, st := base.expr, base.st
+	var field taggedField
+	for _, name := range strings.Split(rest, ".") {
+		if st == nil {
+			return "", "", fmt.Errorf("field %s can not be resolved, %s is not a struct", path, field.Type())
+		}
+		var selector string
+		var found bool
+		field, selector, found = lookupField(st, name)
+		if !found {
+			return "", "", fmt.Errorf("field %s does not exist", path)
+		}
+		if !field.Exported() && field.Pkg() != g.pkg {
+			return "", "", fmt.Errorf("field %s is unexported and can not be accessed by generated code", path)
+		}
+		expr += "." + selector
+		st, _ = field.Type().Underlying().(*types.Struct)
+	}
+
+	return g.setCond(expr, field), joinPath(base.path, rest), nil
+}
+
+// fieldChecks generates the checks of a single struct field based on its type
+func (g *generator) fieldChecks(f *types.Var, expr, path string, tag reflect.StructTag, ancestors []types.Type) error {
+
+	t := f.Type()
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == defconPath && named.Obj().Name() == "Optional" {
+		return fmt.Errorf("field %s: Optional fields are not supported by defcon-gen", f.Name())
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return g.basicChecks(f, expr, tag, u)
+	case *types.Struct:
+		if isOpaque(t) {
+			// Opaque structs such as time.Time are not descended into
+			return g.checkKeys(f, tag)
+		}
+		err := g.checkKeys(f, tag, "required")
+		if err != nil {
+			return err
+		}
+		return g.structChecks(expr, path, t, ancestors)
+	case *types.Slice:
+		return g.listChecks(f, expr, path, tag, u.Elem(), ancestors)
+	case *types.Array:
+		if _, ok := u.Elem().Underlying().(*types.Struct); ok {
+			return g.listChecks(f, expr, path, tag, u.Elem(), ancestors)
+		}
+		return g.checkKeys(f, tag)
+	case *types.Interface:
+		// Reflection processes structs held by interfaces, generated code can not know their types
+		return fmt.Errorf("field %s: interface fields are not supported by defcon-gen, tag the field defcon:\"-\" to leave it unprocessed", f.Name())
+	default:
+		// Maps, pointers etc. are not processed
+		return g.checkKeys(f, tag)
+	}
+}
+
+// checkKeys returns an error if the field has annotations that are not supported on its type by generated code
+func (g *generator) checkKeys(f *types.Var, tag reflect.StructTag, allowed ...string) error {
+	for _, key := range annotationKeys {
+		if _, found := tag.Lookup(key); !found || slices.Contains(allowed, key) || slices.Contains(commonKeys, key) {
+			continue
+		}
+		return fmt.Errorf("field %s: annotation %s is not supported on type %s by defcon-gen", f.Name(), key, f.Type())
+	}
+	return nil
+}
+
+// basicChecks generates the checks of a field of a primitive type
+func (g *generator) basicChecks(f *types.Var, expr string, tag reflect.StructTag, b *types.Basic) error {
+
+	t := f.Type()
+	kind := basicKind(b)
+	var err error
+	switch kind {
+	case "string":
+		err = g.checkKeys(f, tag, "required", "default", "env", "mustmatch", "mustnotmatch")
+	case "int":
+		err = g.checkKeys(f, tag, "required", "default", "env", "validrange")
+	case "float", "bool":
+		err = g.checkKeys(f, tag, "required", "default", "env")
+	case "uint":
+		err = g.checkKeys(f, tag, "required")
+	default:
+		err = g.checkKeys(f, tag)
+	}
+	if err != nil {
+		return err
+	}
+
+	def, _ := tag.Lookup("default")
+	required, err := boolKey(f, tag, "required")
+	if err != nil {
+		return err
+	}
+
+	// Tracks if the value was explicitly provided, so that zero values from environment variables are kept
+	notPresent := ""
+	env, hasEnv := tag.Lookup("env")
+	if hasEnv {
+		track := def != "" || required
+		if track {
+			notPresent = " && !present"
+			g.printf("present := false\n")
+		}
+		g.printf("if %s {\n", g.zero(expr, t))
+		g.printf("if v, ok := %s.LookupEnv(%q); ok {\n", g.use("os", "os"), strings.TrimSpace(env))
+		value := g.parse("v", t, b, envMsg)
+		g.printf("%s = %s\n", expr, value)
+		if track {
+			g.printf("present = true\n")
+		}
+		g.printf("}\n}\n")
+	}
+
+	if def != "" {
+		value, err := literal(def, b)
+		if err != nil {
+			return fmt.Errorf("field %s: failed to set default value: %v", f.Name(), err)
+		}
+		g.printf("if %s%s {\n%s = %s\n}\n", g.zero(expr, t), notPresent, expr, value)
+	}
+
+	if required {
+		g.printf("if %s%s {\nreturn %s\n}\n", g.zero(expr, t), notPresent, g.errorf(requiredMsg))
+	}
+
+	str := expr
+	if !types.Identical(t, types.Typ[types.String]) {
+		str = "string(" + expr + ")"
+	}
+	if pattern, found := tag.Lookup("mustmatch"); found {
+		re, err := g.regexp(pattern)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", f.Name(), err)
+		}
+		g.printf("if %s != \"\" && !%s.MatchString(%s) {\nreturn %s.Errorf(\"field value '%%s' does not match regex '%%s'\", %s, %s)\n}\n", expr, re, str, g.use("fmt", "fmt"), str, re)
+	}
+	if pattern, found := tag.Lookup("mustnotmatch"); found {
+		re, err := g.regexp(pattern)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", f.Name(), err)
+		}
+		g.printf("if %s != \"\" && %s.MatchString(%s) {\nreturn %s.Errorf(\"field value '%%s' matches forbidden regex '%%s'\", %s, %s)\n}\n", expr, re, str, g.use("fmt", "fmt"), str, re)
+	}
+
+	if validRange, found := tag.Lookup("validrange"); found && validRange != "" {
+		cond, err := rangeCond(validRange, "n")
+		if err != nil {
+			return fmt.Errorf("field %s: %s", f.Name(), err)
+		}
+		g.printf("if n := int64(%s); n != 0 && !(%s) {\nreturn %s\n}\n", expr, cond, g.errorf(rangeMsg))
+	}
+
+	return nil
+}
+
+// listChecks generates the checks of a slice, or of an array of structs
+func (g *generator) listChecks(f *types.Var, expr, path string, tag reflect.StructTag, elem types.Type, ancestors []types.Type) error {
+
+	t := f.Type()
+	required, err := boolKey(f, tag, "required")
+	if err != nil {
+		return err
+	}
+
+	// Slices of structs are checked per element
+	if _, ok := elem.Underlying().(*types.Struct); ok {
+		err := g.checkKeys(f, tag, "required")
+		if err != nil {
+			return err
+		}
+		if required {
+			// Arrays always have their length and are empty if all elements are zero values
+			empty := fmt.Sprintf("len(%s) == 0", expr)
+			if _, ok := t.Underlying().(*types.Array); ok {
+				empty = g.zero(expr, t)
+			}
+			g.printf("if %s {\nreturn %s\n}\n", empty, g.errorf(requiredMsg))
+		}
+
+		i := g.ident("i")
+		e := g.ident("e")
+		checks, err := g.block(func() error {
+			return g.structChecks(e, fmt.Sprintf(`%s[" + %s.Itoa(%s) + "]"`, path[:len(path)-1], g.use("strconv", "strconv"), i), elem, ancestors)
+		})
+		if err != nil || checks == "" {
+			return err
+		}
+		name := ""
+		if named, ok := t.(*types.Named); ok {
+			name = named.Obj().Name()
+		}
+		g.printf("for %s := range %s {\n", i, expr)
+		g.printf("if err := func(%s *%s) error {\n%sreturn nil\n}(&%s[%s]); err != nil {\n", e, g.typeString(elem), checks, expr, i)
+		g.printf("return %s.Errorf(\"error in slice %%s at index %%d: %%w\", %q, %s, err)\n}\n}\n", g.use("fmt", "fmt"), name, i)
+		return nil
+	}
+
+	b, ok := elem.Underlying().(*types.Basic)
+	if !ok {
+		return g.checkKeys(f, tag)
+	}
+	kind := basicKind(b)
+	switch kind {
+	case "string":
+		err = g.checkKeys(f, tag, "required", "default", "env", "musthave", "alwayshas", "sep", "unique", "mustmatch", "mustnotmatch")
+	case "int":
+		err = g.checkKeys(f, tag, "required", "default", "env", "musthave", "alwayshas", "sep", "unique", "validrange")
+	case "float":
+		err = g.checkKeys(f, tag, "required", "default", "env", "musthave", "alwayshas", "sep", "unique")
+	default:
+		err = g.checkKeys(f, tag, "required", "unique")
+	}
+	if err != nil {
+		return err
+	}
+
+	def, _ := tag.Lookup("default")
+	sep, found := tag.Lookup("sep")
+	if found && sep == "" {
+		return fmt.Errorf("field %s: invalid annotation syntax: sep must not be empty", f.Name())
+	}
+
+	// Tracks if the value was explicitly provided, so that empty lists from environment variables are kept
+	notPresent := ""
+	env, hasEnv := tag.Lookup("env")
+	if hasEnv {
+		if def != "" {
+			notPresent = " && !present"
+			g.printf("present := false\n")
+		}
+		g.printf("if %s == nil {\n", expr)
+		g.printf("if v, ok := %s.LookupEnv(%q); ok {\n", g.use("os", "os"), strings.TrimSpace(env))
+		g.printf("items, err := %s.ParseList(v, %q)\n", g.use(defconPath, "defcon"), sep)
+		g.printf("if err != nil {\nreturn %s.Errorf(%q, err)\n}\n", g.use("fmt", "fmt"), envMsg)
+		g.printf("parsed := make(%s, 0, len(items))\n", g.typeString(t))
+		g.printf("for _, item := range items {\n")
+		value := g.parse("item", elem, b, envMsg)
+		g.printf("parsed = append(parsed, %s)\n}\n", value)
+		g.printf("%s = parsed\n", expr)
+		if def != "" {
+			g.printf("present = true\n")
+		}
+		g.printf("}\n}\n")
+	}
+
+	if def != "" {
+		_, values, err := literals(def, sep, b)
+		if err != nil {
+			return fmt.Errorf("field %s: failed to set default value: %v", f.Name(), err)
+		}
+		g.printf("if %s == nil%s {\n%s = %s{%s}\n}\n", expr, notPresent, expr, g.typeString(t), strings.Join(values, ", "))
+	}
+
+	if required {
+		g.printf("if len(%s) == 0 {\nreturn %s\n}\n", expr, g.errorf(requiredMsg))
+	}
+
+	if mustHave, found := tag.Lookup("musthave"); found {
+		items, values, err := literals(mustHave, sep, b)
+		if err != nil {
+			return fmt.Errorf("field %s: error comparing values: %s", f.Name(), err)
+		}
+		for j, value := range values {
+			g.printf("if !%s.Contains(%s, %s) {\nreturn %s\n}\n", g.use("slices", "slices"), expr, value,
+				g.errorf("field is marked as must have but has no value for field: %s", items[j]))
+		}
+	}
+
+	if alwaysHas, found := tag.Lookup("alwayshas"); found {
+		_, values, err := literals(alwaysHas, sep, b)
+		if err != nil {
+			return fmt.Errorf("field %s: error comparing values: %s", f.Name(), err)
+		}
+		for _, value := range values {
+			g.printf("if !%s.Contains(%s, %s) {\n%s = append(%s, %s)\n}\n", g.use("slices", "slices"), expr, value, expr, expr, value)
+		}
+	}
+
+	str := "item"
+	if !types.Identical(elem, types.Typ[types.String]) {
+		str = "string(item)"
+	}
+	if pattern, found := tag.Lookup("mustmatch"); found {
+		re, err := g.regexp(pattern)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", f.Name(), err)
+		}
+		g.printf("for _, item := range %s {\nif !%s.MatchString(%s) {\nreturn %s.Errorf(\"field value '%%s' does not match regex '%%s'\", %s, %s)\n}\n}\n", expr, re, str, g.use("fmt", "fmt"), str, re)
+	}
+	if pattern, found := tag.Lookup("mustnotmatch"); found {
+		re, err := g.regexp(pattern)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", f.Name(), err)
+		}
+		g.printf("for _, item := range %s {\nif %s.MatchString(%s) {\nreturn %s.Errorf(\"field value '%%s' matches forbidden regex '%%s'\", %s, %s)\n}\n}\n", expr, re, str, g.use("fmt", "fmt"), str, re)
+	}
+
+	unique, err := boolKey(f, tag, "unique")
+	if err != nil {
+		return err
+	}
+	if unique {
+		g.printf("seen := map[%s]bool{}\n", g.typeString(elem))
+		g.printf("for _, item := range %s {\nif seen[item] {\nreturn %s.Errorf(\"field value '%%v' is not unique\", item)\n}\nseen[item] = true\n}\n", expr, g.use("fmt", "fmt"))
+	}
+
+	if validRange, found := tag.Lookup("validrange"); found && validRange != "" {
+		cond, err := rangeCond(validRange, "n")
+		if err != nil {
+			return fmt.Errorf("field %s: %s", f.Name(), err)
+		}
+		g.printf("for _, item := range %s {\nif n := int64(item); !(%s) {\nreturn %s\n}\n}\n", expr, cond, g.errorf(rangeMsg))
+	}
+
+	return nil
+}
+
+// parse generates parsing of the string expression src into a value of type t and returns an expression of the parsed value.
+// Parse errors are returned from the generated code using the format msg.
+func (g *generator) parse(src string, t types.Type, b *types.Basic, msg string) string {
+
+	var parsed types.Type
+	switch basicKind(b) {
+	case "string":
+		parsed = types.Typ[types.String]
+	case "int":
+		g.printf("p, err := %s.ParseInt(%s, 10, %d)\n", g.use("strconv", "strconv"), src, bitSize(b))
+		parsed = types.Typ[types.Int64]
+	case "float":
+		g.printf("p, err := %s.ParseFloat(%s, %d)\n", g.use("strconv", "strconv"), src, bitSize(b))
+		parsed = types.Typ[types.Float64]
+	case "bool":
+		g.printf("p, err := %s.ParseBool(%s)\n", g.use("strconv", "strconv"), src)
+		parsed = types.Typ[types.Bool]
+	}
+	if basicKind(b) != "string" {
+		g.printf("if err != nil {\nreturn %s.Errorf(%q, err)\n}\n", g.use("fmt", "fmt"), msg)
+		src = "p"
+	}
+	if types.Identical(t, parsed) {
+		return src
+	}
+	return g.typeString(t) + "(" + src + ")"
+}
+
+// zero returns a condition that is true if the expression has the zero value of its type
+func (g *generator) zero(expr string, t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch basicKind(u) {
+		case "string":
+			return expr + ` == ""`
+		case "bool":
+			return "!" + expr
+		case "int", "uint", "float":
+			return expr + " == 0"
+		}
+	case *types.Slice, *types.Map, *types.Pointer, *types.Interface, *types.Signature, *types.Chan:
+		return expr + " == nil"
+	}
+	if types.Comparable(t) {
+		return fmt.Sprintf("%s == (%s{})", expr, g.typeString(t))
+	}
+	return fmt.Sprintf("%s.ValueOf(%s).IsZero()", g.use("reflect", "reflect"), expr)
+}
+
+// nonZero returns a condition that is true if the expression does not have the zero value of its type
+func (g *generator) nonZero(expr string, t types.Type) string {
+	cond := g.zero(expr, t)
+	switch {
+	case strings.HasSuffix(cond, " == nil"), strings.HasSuffix(cond, " == 0"), strings.HasSuffix(cond, ` == ""`):
+		return strings.Replace(cond, " == ", " != ", 1)
+	case strings.HasPrefix(cond, "!"):
+		return cond[1:]
+	default:
+		return "!(" + cond + ")"
+	}
+}
+
+// basicKind returns the type family of a primitive type, or an empty string if it is not supported
+func basicKind(b *types.Basic) string {
+	switch {
+	case b.Info()&types.IsString != 0:
+		return "string"
+	case b.Info()&types.IsBoolean != 0:
+		return "bool"
+	case b.Info()&types.IsInteger != 0 && b.Info()&types.IsUnsigned != 0:
+		if b.Kind() == types.Uintptr {
+			return ""
+		}
+		return "uint"
+	case b.Info()&types.IsInteger != 0:
+		return "int"
+	case b.Info()&types.IsFloat != 0:
+		return "float"
+	default:
+		return ""
+	}
+}
+
+// bitSize returns the bit size used to parse values of a numeric type, 0 for int
+func bitSize(b *types.Basic) int {
+	switch b.Kind() {
+	case types.Int8:
+		return 8
+	case types.Int16:
+		return 16
+	case types.Int32, types.Float32:
+		return 32
+	case types.Int64, types.Float64:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// literal parses an annotation value at generation time and returns it as a Go literal
+func literal(value string, b *types.Basic) (string, error) {
+	switch basicKind(b) {
+	case "string":
+		return quote(value), nil
+	case "int":
+		integer, err := strconv.ParseInt(value, 10, bitSize(b))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(integer, 10), nil
+	case "float":
+		floating, err := strconv.ParseFloat(value, bitSize(b))
+		if err != nil {
+			return "", err
+		}
+		if math.IsInf(floating, 0) || math.IsNaN(floating) {
+			return "", fmt.Errorf("value %s is not supported", value)
+		}
+		return strconv.FormatFloat(floating, 'g', -1, bitSize(b)), nil
+	case "bool":
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(boolean), nil
+	default:
+		return "", fmt.Errorf("type %s is not supported", b)
+	}
+}
+
+// literals parses a list annotation value with defcon.ParseList and returns its elements and their Go literals
+func literals(value, sep string, b *types.Basic) ([]string, []string, error) {
+	items, err := defcon.ParseList(value, sep)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := []string{}
+	for _, item := range items {
+		lit, err := literal(item, b)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, lit)
+	}
+	return items, values, nil
+}
+
+// rangeCond returns a condition that is true if the int64 variable v is within a validrange annotation, e.g. "1-10, 44, 100-200"
+func rangeCond(validRange, v string) (string, error) {
+	conds := []string{}
+	for _, part := range splitList(validRange) {
+		// Search for the range separator after the first character to allow negative lower bounds
+		if idx := strings.Index(part[1:], "-"); idx >= 0 {
+			low, err := strconv.ParseInt(strings.TrimSpace(part[:idx+1]), 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("failed to create interval: %v", err)
+			}
+			high, err := strconv.ParseInt(strings.TrimSpace(part[idx+2:]), 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("failed to create interval: %v", err)
+			}
+			conds = append(conds, fmt.Sprintf("(%s >= %d && %s <= %d)", v, low, v, high))
+		} else {
+			value, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("failed to create interval: %v", err)
+			}
+			conds = append(conds, fmt.Sprintf("%s == %d", v, value))
+		}
+	}
+	if len(conds) == 0 {
+		return "", fmt.Errorf("failed to create interval: empty range")
+	}
+	return strings.Join(conds, " || "), nil
+}
+
+// boolKey parses a boolean annotation
+func boolKey(f *types.Var, tag reflect.StructTag, key string) (bool, error) {
+	value, found := tag.Lookup(key)
+	if !found {
+		return false, nil
+	}
+	boolean, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("field %s: non-boolean value found where expected: %s", f.Name(), err)
+	}
+	return boolean, nil
+}
+
+// splitList splits a comma separated annotation value and trims whitespace from each element
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// taggedField is a struct field together with its tag
+type taggedField struct {
+	*types.Var
+	tag reflect.StructTag
+}
+
+// isInline returns true if the fields of a struct field are promoted to the containing struct, as for embedded structs and fields tagged `defcon:"inline"` or `defcon:"squash"`
+func isInline(f *types.Var, tag reflect.StructTag) (bool, error) {
+	_, isStruct := f.Type().Underlying().(*types.Struct)
+	option, found := tag.Lookup("defcon")
+	if found {
+		switch strings.TrimSpace(option) {
+		case "inline", "squash":
+			if !isStruct || isOpaque(f.Type()) {
+				return false, fmt.Errorf("field %s: defcon:\"%s\" is only supported on struct fields", f.Name(), option)
+			}
+			return true, nil
+		case "-":
+			return false, nil
+		default:
+			return false, fmt.Errorf("field %s: defcon must be inline, squash or -, got %s", f.Name(), option)
+		}
+	}
+	return isStruct && f.Embedded() && !isOpaque(f.Type()), nil
+}
+
+// isOpaque returns true for struct types that are never descended into, as their fields are internal state, e.g. time.Time, sync.Mutex and atomic.Int64
+func isOpaque(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	path := named.Obj().Pkg().Path()
+	return (path == "time" && named.Obj().Name() == "Time") || path == "sync" || path == "sync/atomic"
+}
+
+// lookupField returns the named field of the struct, including fields promoted from inline structs, and the selector of the field from the struct.
+// As for embedded fields in Go, shallower fields take precedence and names that are ambiguous at the same depth are not found.
+func lookupField(st *types.Struct, name string) (taggedField, string, bool) {
+
+	type candidate struct {
+		st       *types.Struct
+		selector string
+	}
+
+	level := []candidate{{st: st}}
+	for len(level) > 0 {
+		found := []taggedField{}
+		selectors := []string{}
+		next := []candidate{}
+		for _, c := range level {
+			for i := 0; i < c.st.NumFields(); i++ {
+				f := taggedField{Var: c.st.Field(i), tag: reflect.StructTag(c.st.Tag(i))}
+				selector := c.selector + f.Name()
+				if f.Name() == name {
+					found = append(found, f)
+					selectors = append(selectors, selector)
+				}
+				if inline, _ := isInline(f.Var, f.tag); inline {
+					next = append(next, candidate{st: f.Type().Underlying().(*types.Struct), selector: selector + "."})
+				}
+			}
+		}
+		switch len(found) {
+		case 0:
+			level = next
+		case 1:
+			return found[0], selectors[0], true
+		default:
+			return taggedField{}, "", false
+		}
+	}
+
+	return taggedField{}, "", false
+}
+
+// isStd returns true for import paths of the standard library, which have no dot in their first element
+func isStd(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// joinPath returns an expression of the path of a field, given the expression of the path of its parent
+func joinPath(path, name string) string {
+	if path == `""` {
+		return strconv.Quote(name)
+	}
+	// Paths always end in a string literal, which the name is appended to
+	return path[:len(path)-1] + "." + name + `"`
+}
+
+// concat returns an expression concatenating string expressions, merging adjacent string literals. Path expressions are split into their operands.
+func concat(exprs ...string) string {
+	operands := []string{}
+	for _, expr := range exprs {
+		operands = append(operands, strings.Split(expr, " + ")...)
+	}
+	parts := []string{}
+	for _, expr := range operands {
+		if len(parts) > 0 {
+			last, err1 := strconv.Unquote(parts[len(parts)-1])
+			next, err2 := strconv.Unquote(expr)
+			if err1 == nil && err2 == nil {
+				parts[len(parts)-1] = strconv.Quote(last + next)
+				continue
+			}
+		}
+		parts = append(parts, expr)
+	}
+	return strings.Join(parts, " + ")
+}
+
+// quote returns a Go string literal, preferring raw strings for values containing backslashes such as regular expressions
+func quote(s string) string {
+	if strings.Contains(s, `\`) && !strings.ContainsAny(s, "`\n\r") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
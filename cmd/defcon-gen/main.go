@@ -0,0 +1,109 @@
+// Command defcon-gen generates reflection free check methods for annotated config structs.
+//
+// Add a go:generate directive next to the config struct and run "go generate";
+//
+//	//go:generate defcon-gen -type Config
+//
+// This writes a DefconCheck method for Config to config_defcon.go, which defcon.CheckStruct calls instead of walking the struct with reflection.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+
+	dir := flag.String("dir", ".", "directory of the package declaring the config struct")
+	typeName := flag.String("type", "", "name of the config struct type (required)")
+	output := flag.String("o", "", "output file, defaults to <type>_defcon.go in the package directory")
+	flag.Parse()
+
+	if *typeName == "" {
+		fmt.Fprintln(os.Stderr, "defcon-gen: flag -type is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = filepath.Join(*dir, strings.ToLower(*typeName)+"_defcon.go")
+	}
+
+	src, err := generateFile(*dir, *typeName, *output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "defcon-gen: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = os.WriteFile(*output, src, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "defcon-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// generateFile type checks the package in dir and generates the check method for the named type
+func generateFile(dir, typeName, output string) ([]byte, error) {
+
+	pkg, err := loadPackage(dir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := pkg.Scope().Lookup(typeName)
+	if obj == nil {
+		return nil, fmt.Errorf("type %s not found in %s", typeName, dir)
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a named type", typeName)
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return nil, fmt.Errorf("type %s is not a struct", typeName)
+	}
+
+	return generate(pkg, named)
+}
+
+// loadPackage parses and type checks the non-test Go files in dir, leaving out any previously generated output.
+// Type errors are ignored as long as the types of the config struct can be resolved.
+func loadPackage(dir, output string) (*types.Package, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	outputAbs, _ := filepath.Abs(output)
+	fset := token.NewFileSet()
+	parsed := []*ast.File{}
+	for _, file := range files {
+		abs, _ := filepath.Abs(file)
+		if strings.HasSuffix(file, "_test.go") || abs == outputAbs {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no Go files found in %s", dir)
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {}, // Keep checking, unresolvable parts are reported when they are used
+	}
+	pkg, _ := conf.Check(parsed[0].Name.Name, fset, parsed, nil)
+
+	return pkg, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test generating a check method for a config struct
+func TestGenerate(t *testing.T) {
+
+	src, err := generateFile("testdata/config", "Config", "testdata/config/config_defcon.go")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, expected := range []string{
+		"// Code generated by defcon-gen; DO NOT EDIT.",
+		"func (c *Config) DefconCheck() error {",
+		`var defconConfigRegexp1 = regexp.MustCompile("^[a-z]+$")`,
+		`if v, ok := os.LookupEnv("TIMEOUT"); ok {`,
+		"c.Timeout = time.Duration(p)",
+		"c.Database.SetDefaults()",
+		`return errors.New("field Database.User requires field Database.Password to be set")`,
+		"if n := int64(c.Database.Port); n != 0 && !(n >= 1 && n <= 65535) {",
+		`return &defcon.FieldError{Path: "Backends[" + strconv.Itoa(i1) + "]", Err: err}`,
+		`return errors.New("at least one backend is required")`,
+		`c.Tags = []string{"a", "b"}`,
+		`if !slices.Contains(c.Ports, 80) {`,
+		`items, err := defcon.ParseList(v, ";")`,
+		`c.Hosts = []string{"a", "b;c"}`,
+		`if c.Pair == ([2]Backend{}) {`,
+		"if n := int64(item); !((n >= 1 && n <= 1024) || n == 8080) {",
+		`if !(c.TLS.Key != "" || func() bool { _, ok := os.LookupEnv("TLS_KEY"); return ok }()) {`,
+		`return errors.New("field Audit requires field File to be set")`,
+		`return errors.New("field Backends[" + strconv.Itoa(i5) + "].Name requires field Database.Host to be set")`,
+		`if !(c.Listen != "" || func() bool { _, ok := os.LookupEnv("LISTEN"); return ok }()) {`,
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Errorf("Generated code does not contain '%s':\n%s", expected, src)
+		}
+	}
+
+	// The debug flag has no default, presence is not tracked
+	if strings.Count(string(src), "present := false") != 6 {
+		t.Errorf("Unexpected tracking of presence:\n%s", src)
+	}
+
+	// Skipped and opaque fields are not processed
+	if strings.Contains(string(src), "CACHE") || strings.Contains(string(src), "c.Started") {
+		t.Errorf("Skipped or opaque fields were processed:\n%s", src)
+	}
+
+	_, err = generateFile("testdata/config", "Missing", "")
+	if err == nil {
+		t.Errorf("Missing type was not detected")
+	}
+
+	_, err = generateFile("testdata/unsupported", "Config", "")
+	if err == nil || !strings.Contains(err.Error(), "annotation ltfield is not supported") {
+		t.Errorf("Unsupported annotation was not detected: %v", err)
+	}
+
+	_, err = generateFile("testdata/unsupported", "Plugin", "")
+	if err == nil || !strings.Contains(err.Error(), "interface fields are not supported") {
+		t.Errorf("Interface field was not detected: %v", err)
+	}
+}
+
+// Test that the generated code builds and has the same outcome as reflection, by running testdata/config/compare_test.go with the generated file overlaid
+func TestGeneratedMatchesReflection(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("builds the generated code with the go command")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	src, err := generateFile("testdata/config", "Config", "testdata/config/config_defcon.go")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	dir := t.TempDir()
+	generated := filepath.Join(dir, "config_defcon.go")
+	err = os.WriteFile(generated, src, 0o644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	target, err := filepath.Abs("testdata/config/config_defcon.go")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	overlay, err := json.Marshal(map[string]any{"Replace": map[string]string{target: generated}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	overlayFile := filepath.Join(dir, "overlay.json")
+	err = os.WriteFile(overlayFile, overlay, 0o644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	out, err := exec.Command(goBin, "test", "-overlay", overlayFile, "./testdata/config").CombinedOutput()
+	if err != nil {
+		t.Errorf("Generated code does not match reflection: %s\n%s", err, out)
+	}
+}
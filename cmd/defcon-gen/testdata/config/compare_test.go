@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/kjansson/defcon"
+)
+
+// Test that the generated check has the same outcome as CheckStruct, which uses reflection when environment variables are looked up with WithLookupEnv.
+// The check is generated by TestGeneratedMatchesReflection in the defcon-gen package, this test does not build on its own.
+func TestGeneratedMatchesReflection(t *testing.T) {
+
+	valid := func() Config {
+		return Config{
+			Database: Database{Password: "secret"},
+			Backends: []Backend{{Name: "a"}},
+			Pair:     [2]Backend{{Name: "b"}, {Name: "c"}},
+			Ports:    []int{80},
+		}
+	}
+
+	tests := map[string]struct {
+		modify func(*Config)
+		env    map[string]string
+	}{
+		"valid":             {modify: func(c *Config) {}},
+		"env":               {modify: func(c *Config) {}, env: map[string]string{"LISTEN": "", "TIMEOUT": "1", "DEBUG": "true", "DB_PORT": "6543", "TAGS": "x, y", "HOSTS": "c;d", "TLS_KEY": "key.pem"}},
+		"invalid env":       {modify: func(c *Config) {}, env: map[string]string{"DB_PORT": "port"}},
+		"preset":            {modify: func(c *Config) { c.Listen, c.Tags, c.Database.User = ":9090", []string{"base"}, "root" }},
+		"missing backends":  {modify: func(c *Config) { c.Backends = nil }},
+		"missing pair":      {modify: func(c *Config) { c.Pair = [2]Backend{} }},
+		"invalid name":      {modify: func(c *Config) { c.Backends[0].Name = "A" }},
+		"missing name":      {modify: func(c *Config) { c.Backends = append(c.Backends, Backend{Weight: 1}) }},
+		"negative weight":   {modify: func(c *Config) { c.Backends[0].Weight = -1 }},
+		"port out of range": {modify: func(c *Config) { c.Database.Port = 70000 }},
+		"list out of range": {modify: func(c *Config) { c.Ports = []int{80, 8081} }},
+		"musthave":          {modify: func(c *Config) { c.Ports = []int{443} }},
+		"duplicate tags":    {modify: func(c *Config) { c.Tags = []string{"a", "a"} }},
+		"missing password":  {modify: func(c *Config) { c.Database.Password = "" }},
+		"audit":             {modify: func(c *Config) { c.Audit = true }},
+		"audit with file":   {modify: func(c *Config) { c.Audit, c.File, c.TLS.Key = true, "audit.log", "key.pem" }},
+		"proxy":             {modify: func(c *Config) { c.Proxy = "proxy:3128" }},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			generated, reflected := valid(), valid()
+			test.modify(&generated)
+			test.modify(&reflected)
+
+			generatedErr := generated.DefconCheck()
+			reflectedErr := defcon.CheckStruct(&reflected, defcon.WithLookupEnv(os.LookupEnv))
+			if fmt.Sprint(generatedErr) != fmt.Sprint(reflectedErr) {
+				t.Fatalf("Generated check returned '%v', reflection returned '%v'", generatedErr, reflectedErr)
+			}
+			if reflectedErr == nil && !reflect.DeepEqual(generated, reflected) {
+				t.Errorf("Generated check set\n%+v\nreflection set\n%+v", generated, reflected)
+			}
+		})
+	}
+}
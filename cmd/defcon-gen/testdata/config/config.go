@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+type Database struct {
+	Host     string `env:"DB_HOST" default:"localhost"`
+	Port     int    `env:"DB_PORT" default:"5432" validrange:"1-65535"`
+	User     string `requires:"Password"`
+	Password string `env:"DB_PASSWORD" secret:"true"`
+}
+
+func (d *Database) SetDefaults() {
+	if d.User == "" {
+		d.User = "admin"
+	}
+}
+
+type Backend struct {
+	Name   string  `required:"true" mustmatch:"^[a-z]+$" requires:"Listen, ..Database.Host"`
+	Weight float64 `default:"1.5"`
+}
+
+func (b Backend) Validate() error {
+	if b.Weight < 0 {
+		return errors.New("weight must not be negative")
+	}
+	return nil
+}
+
+type Logging struct {
+	Level string `default:"info"`
+	File  string
+}
+
+type TLS struct {
+	Cert string
+	Key  string `env:"TLS_KEY"`
+}
+
+type Config struct {
+	Logging
+	Listen    string        `env:"LISTEN" default:":8080"`
+	Timeout   time.Duration `env:"TIMEOUT" default:"5000000000"`
+	Debug     bool          `env:"DEBUG"`
+	Database  Database
+	Backends  []Backend  `required:"true" errormsg:"at least one backend is required"`
+	Tags      []string   `env:"TAGS" default:"{a, b}" alwayshas:"base" unique:"true"`
+	Ports     []int      `musthave:"80" validrange:"1-1024, 8080"`
+	Hosts     []string   `env:"HOSTS" default:"a; \"b;c\"" sep:";"`
+	Pair      [2]Backend `required:"true"`
+	TLS       TLS        `defcon:"inline"`
+	Audit     bool       `requires:"File, Key"`
+	Proxy     string     `requires:"ProxyPort"`
+	ProxyPort int        `default:"3128"`
+	Started   time.Time
+	Cache     map[string]string `defcon:"-" env:"CACHE"`
+}
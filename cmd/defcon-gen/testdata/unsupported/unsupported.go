@@ -0,0 +1,11 @@
+package unsupported
+
+type Config struct {
+	Min int `ltfield:"Max"`
+	Max int
+}
+
+type Plugin struct {
+	Name    string
+	Storage any
+}
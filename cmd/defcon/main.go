@@ -0,0 +1,125 @@
+// Command defcon generates documentation and other artifacts from annotated config structs in Go source
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kjansson/defcon/internal/spec"
+)
+
+const usage = `usage: defcon <command> [flags]
+
+commands:
+  docs    generate Markdown or HTML documentation for a config struct
+  env     generate a .env.example, Kubernetes env section or ConfigMap for a config struct
+
+Run "defcon <command> -h" for the flags of a command.
+`
+
+func main() {
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "docs":
+		err = docs(os.Args[2:])
+	case "env":
+		err = env(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "defcon %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// docs generates documentation for a config struct
+func docs(args []string) error {
+
+	flags := flag.NewFlagSet("docs", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory of the package declaring the config struct")
+	typeName := flags.String("type", "", "name of the config struct type (required)")
+	format := flags.String("format", "markdown", "output format, markdown or html")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	_ = flags.Parse(args)
+
+	if *typeName == "" {
+		return fmt.Errorf("flag -type is required")
+	}
+
+	fields, err := loadFields(*dir, *typeName)
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		defer out.Close()
+	}
+
+	switch *format {
+	case "markdown":
+		return spec.WriteMarkdown(out, fields)
+	case "html":
+		return spec.WriteHTML(out, fields)
+	default:
+		return fmt.Errorf("unsupported format %s", *format)
+	}
+}
+
+// env generates an example environment for a config struct
+func env(args []string) error {
+
+	flags := flag.NewFlagSet("env", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory of the package declaring the config struct")
+	typeName := flags.String("type", "", "name of the config struct type (required)")
+	format := flags.String("format", "dotenv", "output format, dotenv, k8s-env or configmap")
+	name := flags.String("name", "", "name of the ConfigMap or Secret referenced by secrets, defaults to the type name in kebab case")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	_ = flags.Parse(args)
+
+	if *typeName == "" {
+		return fmt.Errorf("flag -type is required")
+	}
+	if *name == "" {
+		*name = spec.KebabCase(*typeName)
+	}
+
+	fields, err := loadFields(*dir, *typeName)
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		defer out.Close()
+	}
+
+	switch *format {
+	case "dotenv":
+		return spec.WriteEnvExample(out, fields)
+	case "k8s-env":
+		return spec.WriteKubernetesEnv(out, fields, *name)
+	case "configmap":
+		return spec.WriteConfigMap(out, fields, *name)
+	default:
+		return fmt.Errorf("unsupported format %s", *format)
+	}
+}
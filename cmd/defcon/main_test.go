@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kjansson/defcon/internal/spec"
+)
+
+// Test loading fields of a config struct from source
+func TestLoadFields(t *testing.T) {
+
+	fields, err := loadFields("testdata/config", "Config")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []string{"Listen", "Timeout", "Database.Host", "Database.Port", "Database.Password", "Backends[].Name", "Tags", "Level", "Cert"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Unexpected number of fields. Wanted %d, got %d", len(expected), len(fields))
+	}
+	for i, path := range expected {
+		if fields[i].Path != path {
+			t.Errorf("Unexpected field path. Wanted '%s', got '%s'", path, fields[i].Path)
+		}
+	}
+	if fields[1].Type != "time.Duration" || fields[1].Lookup("env") != "TIMEOUT" {
+		t.Errorf("Type or annotations not loaded correctly: %+v", fields[1])
+	}
+
+	_, err = loadFields("testdata/config", "Missing")
+	if err == nil {
+		t.Errorf("Missing type was not detected")
+	}
+}
+
+// Test generating Markdown documentation from source
+func TestDocsMarkdown(t *testing.T) {
+
+	fields, err := loadFields("testdata/config", "Config")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	var b strings.Builder
+	err = spec.WriteMarkdown(&b, fields)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, expected := range []string{"| `Database.Port` | `int` | `DB_PORT` | `5432` |  | `1-65535` |", "Address to listen on", "`^[a-z]+$`"} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("Documentation does not contain '%s':\n%s", expected, b.String())
+		}
+	}
+}
+
+// Test generating a .env.example and Kubernetes resources from source
+func TestEnv(t *testing.T) {
+
+	fields, err := loadFields("testdata/config", "Config")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	var b strings.Builder
+	err = spec.WriteEnvExample(&b, fields)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, expected := range []string{"# Database.Host (string)\n# Database host\nDB_HOST=localhost\n", "# Required\n# Secret\nDB_PASSWORD=\n", "TAGS={a, b}\n"} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf(".env.example does not contain '%s':\n%s", expected, b.String())
+		}
+	}
+
+	b.Reset()
+	err = spec.WriteKubernetesEnv(&b, fields, "config")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, expected := range []string{"  - name: DB_PORT\n    value: \"5432\"\n", "  - name: DB_PASSWORD\n    valueFrom:\n      secretKeyRef:\n        name: config\n        key: DB_PASSWORD\n"} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("Kubernetes env does not contain '%s':\n%s", expected, b.String())
+		}
+	}
+
+	b.Reset()
+	err = spec.WriteConfigMap(&b, fields, spec.KebabCase("HTTPServerConfig"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(b.String(), "  name: http-server-config\n") || !strings.Contains(b.String(), "  LISTEN: \":8080\"\n") {
+		t.Errorf("ConfigMap not generated correctly:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), "DB_PASSWORD") {
+		t.Errorf("Secret was included in ConfigMap")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kjansson/defcon/internal/spec"
+)
+
+// loadFields parses the Go files in dir and returns the leaf fields of the named struct type
+func loadFields(dir, typeName string) ([]spec.Field, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect all type declarations in the package
+	fset := token.NewFileSet()
+	typeSpecs := map[string]*ast.TypeSpec{}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range gen.Specs {
+				typeSpec := s.(*ast.TypeSpec)
+				typeSpecs[typeSpec.Name.Name] = typeSpec
+			}
+		}
+	}
+
+	root, found := typeSpecs[typeName]
+	if !found {
+		return nil, fmt.Errorf("type %s not found in %s", typeName, dir)
+	}
+	st, ok := root.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not a struct", typeName)
+	}
+
+	w := &sourceWalker{typeSpecs: typeSpecs, fields: []spec.Field{}}
+	err = w.walk(st, "", []string{typeName})
+	if err != nil {
+		return nil, err
+	}
+
+	return w.fields, nil
+}
+
+// sourceWalker walks struct types in source the same way defcon walks them with reflection
+type sourceWalker struct {
+	typeSpecs map[string]*ast.TypeSpec
+	fields    []spec.Field
+}
+
+// structType resolves an expression to a struct type declared in the package, returning the type name for named types
+func (w *sourceWalker) structType(expr ast.Expr) (*ast.StructType, string) {
+	switch expr := expr.(type) {
+	case *ast.StructType:
+		return expr, ""
+	case *ast.Ident:
+		typeSpec, found := w.typeSpecs[expr.Name]
+		if !found || typeSpec.TypeParams != nil {
+			return nil, ""
+		}
+		st, ok := typeSpec.Type.(*ast.StructType)
+		if !ok {
+			return nil, ""
+		}
+		return st, expr.Name
+	default:
+		return nil, ""
+	}
+}
+
+func (w *sourceWalker) walk(st *ast.StructType, path string, ancestors []string) error {
+
+	for _, field := range st.Fields.List {
+
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			raw, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return fmt.Errorf("invalid struct tag %s: %s", field.Tag.Value, err)
+			}
+			tag = reflect.StructTag(raw)
+		}
+
+		names := []string{}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		if len(names) == 0 {
+			// Embedded fields are named after their type
+			names = append(names, embeddedName(field.Type))
+		}
+
+		option := strings.TrimSpace(tag.Get("defcon"))
+		inline := len(field.Names) == 0 || option == "inline" || option == "squash"
+		if option == "-" {
+			continue
+		}
+
+		for _, name := range names {
+			fieldPath := spec.Join(path, name)
+			typeString := types.ExprString(field.Type)
+
+			// Nested structs are walked recursively, fields of embedded and inline structs have the path of the containing struct
+			if nested, typeName := w.structType(field.Type); nested != nil && !slices.Contains(ancestors, typeName) {
+				if inline {
+					fieldPath = path
+				}
+				err := w.walk(nested, fieldPath, append(ancestors, typeName))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Elements of slices and arrays of structs are walked recursively
+			if array, ok := field.Type.(*ast.ArrayType); ok {
+				if nested, typeName := w.structType(array.Elt); nested != nil && !slices.Contains(ancestors, typeName) {
+					err := w.walk(nested, fieldPath+"[]", append(ancestors, typeName))
+					if err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			w.fields = append(w.fields, spec.Field{Path: fieldPath, Type: typeString, Tag: tag})
+		}
+	}
+
+	return nil
+}
+
+// embeddedName returns the field name of an embedded type
+func embeddedName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name
+	case *ast.SelectorExpr:
+		return expr.Sel.Name
+	case *ast.StarExpr:
+		return embeddedName(expr.X)
+	case *ast.IndexExpr:
+		return embeddedName(expr.X)
+	case *ast.IndexListExpr:
+		return embeddedName(expr.X)
+	default:
+		return types.ExprString(expr)
+	}
+}
+
+// openOutput returns a writer for the output flag, stdout if empty
+func openOutput(output string) (*os.File, error) {
+	if output == "" {
+		return os.Stdout, nil
+	}
+	return os.Create(output)
+}
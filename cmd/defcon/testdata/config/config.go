@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+type Database struct {
+	Host     string `env:"DB_HOST" default:"localhost" desc:"Database host"`
+	Port     int    `env:"DB_PORT" default:"5432" validrange:"1-65535"`
+	Password string `env:"DB_PASSWORD" required:"true" secret:"true"`
+}
+
+type Backend struct {
+	Name string `mustmatch:"^[a-z]+$" desc:"Name of the backend"`
+}
+
+type Logging struct {
+	Level string `env:"LOG_LEVEL" default:"info"`
+}
+
+type TLS struct {
+	Cert string `env:"TLS_CERT"`
+}
+
+type Config struct {
+	Listen   string        `env:"LISTEN" default:":8080" desc:"Address to listen on"`
+	Timeout  time.Duration `env:"TIMEOUT" default:"5000000000"`
+	Database Database
+	Backends []Backend
+	Tags     []string `env:"TAGS" default:"{a, b}"`
+	Logging
+	TLS TLS `defcon:"inline"`
+}
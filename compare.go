@@ -0,0 +1,136 @@
+package defcon
+
+import (
+	"cmp"
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// lookupField resolves a field name or dotted path (e.g. "TLS.MinVersion") relative to a struct value
+func lookupField(val reflect.Value, path string) (reflect.Value, error) {
+
+	current := val
+	for _, name := range strings.Split(path, ".") {
+		if !token.IsIdentifier(name) {
+			return reflect.Value{}, fmt.Errorf("field %s does not seem to have a valid name", path)
+		}
+		if current.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("field %s can not be resolved, %s is not a struct", path, current.Type())
+		}
+		sf, found := fieldByName(current.Type(), name)
+		if !found {
+			return reflect.Value{}, fmt.Errorf("field %s does not exist", path)
+		}
+		next := current.FieldByIndex(sf.Index)
+		// Create a exported version of the field if it is unexported, or promoted from an unexported inline struct, to allow access to its value
+		if !next.CanInterface() && next.CanAddr() {
+			next = reflect.NewAt(next.Type(), unsafe.Pointer(next.UnsafeAddr())).Elem()
+		}
+		current = next
+	}
+
+	return current, nil
+}
+
+// compareValues compares two numeric or string values, returning -1, 0 or 1 if a is less than, equal to or greater than b
+func compareValues(a, b reflect.Value) (int, error) {
+
+	aFamily, _, err := getTypeDetails(a.Type())
+	if err != nil {
+		return 0, fmt.Errorf("could not determine type: %s", err)
+	}
+	bFamily, _, err := getTypeDetails(b.Type())
+	if err != nil {
+		return 0, fmt.Errorf("could not determine type: %s", err)
+	}
+
+	switch {
+	case aFamily == "string" && bFamily == "string":
+		return strings.Compare(a.String(), b.String()), nil
+	case aFamily == "int" && bFamily == "int":
+		return cmp.Compare(a.Int(), b.Int()), nil
+	case aFamily == "uint" && bFamily == "uint":
+		return cmp.Compare(a.Uint(), b.Uint()), nil
+	case isNumeric(aFamily) && isNumeric(bFamily):
+		// Mixed numeric types are compared as floats
+		return cmp.Compare(toFloat(a), toFloat(b)), nil
+	default:
+		return 0, fmt.Errorf("can not compare %s with %s", a.Type(), b.Type())
+	}
+}
+
+// isNumeric returns true if the type family is an integer, unsigned integer or float
+func isNumeric(family string) bool {
+	return family == "int" || family == "uint" || family == "float"
+}
+
+// toFloat converts a numeric value to float64
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// checkComparisons validates the cross-field comparison annotations declared on a struct field
+func checkComparisons(val *reflect.Value, fieldName string, annotations *annotations) error {
+
+	comparisons := []struct {
+		tag   string
+		other string
+		valid func(int) bool
+		text  string
+	}{
+		{"ltfield", annotations.LtField, func(c int) bool { return c < 0 }, "less than"},
+		{"ltefield", annotations.LteField, func(c int) bool { return c <= 0 }, "less than or equal to"},
+		{"gtfield", annotations.GtField, func(c int) bool { return c > 0 }, "greater than"},
+		{"gtefield", annotations.GteField, func(c int) bool { return c >= 0 }, "greater than or equal to"},
+		{"eqfield", annotations.EqField, func(c int) bool { return c == 0 }, "equal to"},
+		{"nefield", annotations.NeField, func(c int) bool { return c != 0 }, "not equal to"},
+	}
+
+	field, err := lookupField(*val, fieldName)
+	if err != nil {
+		return err
+	}
+
+	// Comparisons are only evaluated when the annotated field is set
+	field, present := unwrapOptional(field)
+	if !present {
+		return nil
+	}
+
+	for _, comparison := range comparisons {
+		if comparison.other == "" {
+			continue
+		}
+		other, err := lookupField(*val, comparison.other)
+		if err != nil {
+			return fmt.Errorf("field %s referenced by %s annotation on field %s: %s", comparison.other, comparison.tag, fieldName, err)
+		}
+		// Unset Optional fields have no value to compare with, as for the annotated field
+		if isOptional(other.Type()) {
+			var present bool
+			other, present = unwrapOptional(other)
+			if !present {
+				continue
+			}
+		}
+		c, err := compareValues(field, other)
+		if err != nil {
+			return fmt.Errorf("field %s can not be compared with field %s: %s", fieldName, comparison.other, err)
+		}
+		if !comparison.valid(c) {
+			return fmt.Errorf("field %s must be %s field %s", fieldName, comparison.text, comparison.other)
+		}
+	}
+
+	return nil
+}
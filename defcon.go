@@ -2,6 +2,7 @@
 package defcon
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -11,28 +12,71 @@ import (
 
 // CheckStruct accepts a struct and will validate and alter structs field values according to instructions in their annotations. It will recursively process any containing nested structs an slices of structs.
 // Supported annotations and applicable types are;
-// "default" - all primitive types and slices of primitives - modifies the struct field with the given value if field is not set
+// "default" - all primitive types, slices of primitives and slices of structs - modifies the struct field with the given value if field is not set, slices of structs take a JSON array of objects
 // "required" - all types - returns an error if field is not set
-// "env" - all primitive types - modifies struct field with value of environment variable if found
-// "requires" - all fields - declares a dependency to another field(s) in the same struct, returns an error if dependent field(s) is not set
+// "env" - all primitive types, slices of primitives and slices of structs - modifies struct field with value of environment variable if found
+// "requires" - all fields - declares a dependency to other field(s) in the same struct, or paths such as "Database.Host" from the root struct and "..TLS.CertFile" relative to the parent struct, returns an error if dependent field(s) is not set
+// "excludes" - all fields - declares fields in the same struct that must not be set together with the field, returns an error if any of them is set
+// "exactlyone", "atleastone", "atmostone" - all fields, typically a marker field "_ struct{}" - declares a group of fields in the same struct of which exactly one, at least one or at most one must be set
+// "ltfield", "ltefield", "gtfield", "gtefield", "eqfield", "nefield" - numerics, durations and strings - compares the field to another field in the same struct or a dotted path to a nested field, returns an error if the comparison fails
 // "musthave" - slices of primitives - defines a list of values that must be present in a slice, returns an error if any of the values are not present
 // "unique" - slices of primitives - returns an error of the slice contains duplicate values
 // "alwayshas" - slices of primitives - modifies a slice to always contain the given values, if not present they will be appended at validation time
+// "sep" - slices of primitives - separator of list values in "default", "env", "musthave" and "alwayshas", commas and newlines if not given
 // "mustmatch" - strings and slices of strings - returns an error if string(s) do not match the given regular expression
 // "mustnotmatch - strings and slices of strings - returns an error if string(s) does match the given regular expression
-// "validrange" - integers and slices of integers - returns an error if value(s) are not within the given range, e.g. "1-10, 44, 100-200"
+// "validrange" - signed integers and slices of signed integers - returns an error if value(s) are not within the given range, e.g. "1-10, 44, 100-200"
+// "validate" - all types, per element for slices - runs named validators registered with RegisterValidator, e.g. "region, tenant=prod"
+// "assert" - all fields, typically a marker field "_ struct{}" - evaluates an expression against the containing struct, returns an error if it is not true
 // "errormsg" - all types - allows for a custom error message to be returned if validation fails for the field
+// "defcon" - structs for "inline" and "squash", all fields for "-" - "inline" and "squash" promote the fields of a named struct field to the containing struct, as for embedded structs, "-" skips the field and any nested fields
+// "oneoftype" - interfaces - selects the type held by the field from the given discriminator property of JSON objects, with types registered by RegisterType
+// "secret" - all fields - redacts the value of the field and any nested fields in reports, Dump and Diff
+// "desc" - all fields - describes the field in generated documentation, schemas and environment files
+// "reload" - all fields - classifies changes of the field and any nested fields reported by Diff as "live" or "restart"
+//
+// Options can be given to alter the behaviour, e.g. WithReport to record where the value of every field came from.
+func CheckStruct(config interface{}, opts ...Option) error {
+
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Pointer {
+		return fmt.Errorf("config must be a pointer to a struct, got %T", config)
+	}
+	if v.IsNil() {
+		return fmt.Errorf("config must be a pointer to a struct, got nil %s", v.Type())
+	}
+	if v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to a struct, got %s", v.Type())
+	}
+
+	o := newOptions(opts)
 
-func CheckStruct(config interface{}) error {
+	// Use the reflection free check generated by defcon-gen if present, reports, custom environment lookups and skipping unexported fields require reflection
+	if checker, ok := config.(Checker); ok && o.report == nil && !o.customEnv && !o.skipUnexported {
+		return checker.DefconCheck()
+	}
+
+	s := v.Elem()
+	o.visited.add(v)
 
-	s := reflect.ValueOf(config).Elem()
+	if o.report != nil {
+		o.report.Fields = []FieldSource{}
+	}
 
 	field := structField{}
-	err := field.handle(&s, nil) // Initial call does not have annotations, it will be populated in the structField.handle method
+	err := field.handle(&state{opts: o}, &s, nil) // Initial call does not have annotations, it will be populated in the structField.handle method
 	if err != nil {
 		return err
 	}
 
+	// Validate "requires" tags against the fully processed config
+	for _, check := range o.requires {
+		err = check()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -56,8 +100,8 @@ func getTypeDetails(v reflect.Type) (string, int, error) {
 	return family[1], bits, nil
 }
 
-// Sets a value back into reflect.Value by determing it's value and parsing the value from a string
-func setValue(v *reflect.Value, val string) error {
+// Sets a value back into reflect.Value by determing it's value and parsing the value from a string, lists are split by ParseList with the separator of the given format
+func setValue(v *reflect.Value, val string, format listFormat) error {
 
 	family, bits, err := getTypeDetails(v.Type()) // Get type family and number of bits if applicable
 	if err != nil {
@@ -72,6 +116,12 @@ func setValue(v *reflect.Value, val string) error {
 			return err
 		}
 		v.SetInt(integer)
+	case "uint":
+		integer, err := strconv.ParseUint(val, 10, bits) // Parse string to unsigned int
+		if err != nil {
+			return err
+		}
+		v.SetUint(integer)
 	case "float":
 		floating, err := strconv.ParseFloat(val, bits) // Parse string to float
 		if err != nil {
@@ -88,108 +138,61 @@ func setValue(v *reflect.Value, val string) error {
 		v.SetString(val)
 	case "slice":
 
-		t := v.Type().Elem() // Get the type of the slice elements
-		eType, bits, err := getTypeDetails(t)
+		// Slices of structs take a JSON array of objects, decoded with field names or json tags
+		if isStructList(v.Type()) {
+			slice := reflect.New(v.Type())
+			decoder := json.NewDecoder(strings.NewReader(val))
+			decoder.DisallowUnknownFields()
+			err := decodeJSON(decoder, slice.Interface())
+			if err != nil {
+				return fmt.Errorf("invalid JSON array of %s: %s", v.Type().Elem(), err)
+			}
+			v.Set(slice.Elem())
+			return nil
+		}
+
+		eType, _, err := getTypeDetails(v.Type().Elem()) // Get the type family of the slice elements
 		if err != nil {
 			return fmt.Errorf("could not determine element type: %s", err)
 		}
-		var uv = reflect.Value{}
 		switch eType {
-		case "int":
-			values := strings.Split(regexp.MustCompile("^{(.*)}").FindStringSubmatch(val)[1], ",")
-			switch bits {
-			case 8:
-				us := make([]int8, 0)   // Create a slice of strings
-				u := &us                // Create a pointer to the slice
-				uv = reflect.ValueOf(u) // Get the reflect value of the pointer
-			case 16:
-				us := make([]int16, 0)
-				u := &us
-				uv = reflect.ValueOf(u)
-			case 32:
-				us := make([]int32, 0)
-				u := &us
-				uv = reflect.ValueOf(u)
-			case 64:
-				us := make([]int64, 0)
-				u := &us
-				uv = reflect.ValueOf(u)
-			default:
-				us := make([]int, 0)
-				u := &us
-				uv = reflect.ValueOf(u)
-			}
-			for _, x := range values { // Loop through all values
-				numVal, err := strconv.ParseInt(strings.TrimSpace(x), 10, bits) // Parse string to int
-				if err != nil {
-					return err
-				}
-				switch bits {
-				case 8:
-					y := reflect.ValueOf(int8(numVal)) // Get the reflect value of the value
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				case 16:
-					y := reflect.ValueOf(int16(numVal))
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				case 32:
-					y := reflect.ValueOf(int32(numVal))
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				case 64:
-					y := reflect.ValueOf(int64(numVal))
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				default:
-					y := reflect.ValueOf(int(numVal))
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				}
-			}
-			v.Set(uv.Elem()) // Set the value of the reflect value to the slice
-		case "float":
-			values := strings.Split(regexp.MustCompile("^{(.*)}").FindStringSubmatch(val)[1], ",")
-			switch bits {
-			case 32:
-				us := make([]float32, 0) // Create a slice of strings
-				u := &us                 // Create a pointer to the slice
-				uv = reflect.ValueOf(u)  // Get the reflect value of the pointer
-			case 64:
-				us := make([]float64, 0)
-				u := &us
-				uv = reflect.ValueOf(u)
-			default:
-				us := make([]float64, 0)
-				u := &us
-				uv = reflect.ValueOf(u)
-			}
-			for _, x := range values { // Loop through all values
-				numVal, err := strconv.ParseFloat(strings.TrimSpace(x), bits) // Parse string to int
-				if err != nil {
-					return err
-				}
-				switch bits {
-				case 32:
-					y := reflect.ValueOf(float32(numVal)) // Get the reflect value of the value
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				case 64:
-					y := reflect.ValueOf(float64(numVal))
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				default:
-					y := reflect.ValueOf(float64(numVal))
-					uv.Elem().Set(reflect.Append(uv.Elem(), y))
-				}
-			}
-			v.Set(uv.Elem()) // Set the value of the reflect value to the slice
-		case "string":
-			values := strings.Split(regexp.MustCompile("^{(.*)}").FindStringSubmatch(val)[1], ",")
-			us := make([]string, 0)    // Create a slice of strings
-			u := &us                   // Create a pointer to the slice
-			uv := reflect.ValueOf(u)   // Get the reflect value of the pointer
-			for _, x := range values { // Loop through all values
-				y := reflect.ValueOf(strings.TrimSpace(x))  // Get the reflect value of the value
-				uv.Elem().Set(reflect.Append(uv.Elem(), y)) // Append the value to the slice
-			}
-			v.Set(uv.Elem()) // Set the value of the reflect value to the slice
+		case "int", "uint", "float", "bool", "string":
 		default:
 			return fmt.Errorf("slice type %s is not supported", eType)
 		}
+
+		values, err := ParseList(val, format.sep)
+		if err != nil {
+			return err
+		}
+
+		// Build a slice of the field's own type, so that named slice and element types are kept
+		slice := reflect.MakeSlice(v.Type(), 0, len(values))
+		for _, x := range values {
+			element := reflect.New(v.Type().Elem()).Elem()
+			err := setValue(&element, x, listFormat{})
+			if err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, element)
+		}
+		v.Set(slice) // Only set the field once all values are parsed
+	case "array":
+
+		// Arrays take the same values as slices, with exactly as many elements as their length unless padding is allowed
+		slice := reflect.New(reflect.SliceOf(v.Type().Elem())).Elem()
+		err := setValue(&slice, val, format)
+		if err != nil {
+			return err
+		}
+		if slice.Len() > v.Len() || (slice.Len() < v.Len() && !format.pad) {
+			return fmt.Errorf("array of type %s takes exactly %d elements, got %d", v.Type(), v.Len(), slice.Len())
+		}
+		array := reflect.New(v.Type()).Elem()
+		reflect.Copy(array, slice)
+		v.Set(array)
+	default:
+		return fmt.Errorf("type %s is not supported", v.Type())
 	}
 	return nil
 }
@@ -197,59 +200,21 @@ func setValue(v *reflect.Value, val string) error {
 // createTypeFromValue returns a reflect.Value of same type as typedValue, containing the value from untypedValueString if value is parseable for the type
 func createTypeFromValue(typedValue reflect.Value, untypedValueString string) (reflect.Value, error) {
 
-	family, bits, err := getTypeDetails(typedValue.Type()) // Get type family and number of bits if applicable
+	family, _, err := getTypeDetails(typedValue.Type()) // Get type family and number of bits if applicable
 	if err != nil {
 		return reflect.Value{}, fmt.Errorf("could not determine type: %s", err)
 	}
-	untypedValueString = strings.TrimSpace(untypedValueString)
-
-	// Parse numerical values if needed and set values
 	switch family {
-	case "int":
-		integer, err := strconv.ParseInt(untypedValueString, 10, bits) // Parse string to int
-		if err != nil {
-			return reflect.Value{}, err
-		}
-
-		switch bits {
-		case 8:
-			return reflect.ValueOf(int8(integer)), nil
-		case 16:
-			return reflect.ValueOf(int16(integer)), nil
-		case 32:
-			return reflect.ValueOf(int32(integer)), nil
-		case 64:
-			return reflect.ValueOf(int64(integer)), nil
-		default:
-			return reflect.ValueOf(int(integer)), nil
-		}
-	case "float":
-		floating, err := strconv.ParseFloat(untypedValueString, bits) // Parse string to float
-		if err != nil {
-			return reflect.Value{}, err
-		}
-
-		switch bits {
-		case 32:
-			return reflect.ValueOf(float32(floating)), nil
-		case 64:
-			return reflect.ValueOf(float64(floating)), nil
-		default:
-			return reflect.ValueOf(float64(floating)), nil
-		}
-
-	case "bool":
-		boolean, err := strconv.ParseBool(untypedValueString) // Parse string to bool (accepts "true", "false", "TRUE", "FALSE", "True", "False", "1", "0")
-		if err != nil {
-			return reflect.Value{}, err
-		}
-		return reflect.ValueOf(boolean), nil
-
-	case "string":
-		return reflect.ValueOf(untypedValueString), nil
-
+	case "int", "uint", "float", "bool", "string":
 	default:
 		return reflect.Value{}, fmt.Errorf("could not determine type")
+	}
 
+	// Parse into a new value of the same type, so that named types are kept
+	v := reflect.New(typedValue.Type()).Elem()
+	err = setValue(&v, untypedValueString, listFormat{})
+	if err != nil {
+		return reflect.Value{}, err
 	}
+	return v, nil
 }
@@ -1,8 +1,21 @@
 package defcon
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // Test default values for default int
@@ -1694,3 +1707,2488 @@ func TestMustMatchInvalidEmail(t *testing.T) {
 	}
 
 }
+
+// Test excludes with both fields set
+func TestExcludes(t *testing.T) {
+
+	type testStruct struct {
+		Token    string `excludes:"Username, Password"`
+		Username string
+		Password string
+	}
+
+	test := testStruct{Token: "token", Username: "user"}
+	err := CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Field set together with excluded field was not detected")
+	}
+
+	test = testStruct{Token: "token"}
+	err = CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Field without excluded fields set should be valid: %s", err)
+	}
+
+	type misspelledStruct struct {
+		Token    string `excludes:"Usename"`
+		Username string
+	}
+
+	err = CheckStruct(&misspelledStruct{})
+	if err == nil || err.Error() != "field Usename referenced by field Token does not exist" {
+		t.Errorf("Excluded field that does not exist was not detected: %v", err)
+	}
+}
+
+// Test exactlyone declared on a marker field
+func TestExactlyOne(t *testing.T) {
+
+	type testStruct struct {
+		_        struct{} `exactlyone:"Token, Username"`
+		Token    string
+		Username string
+	}
+
+	test := testStruct{}
+	err := CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Exactly one constraint with no fields set was not detected")
+	}
+
+	test = testStruct{Token: "token", Username: "user"}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Exactly one constraint with two fields set was not detected")
+	}
+
+	test = testStruct{Username: "user"}
+	err = CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Exactly one constraint with one field set should be valid: %s", err)
+	}
+
+	type missingStruct struct {
+		_     struct{} `exactlyone:"Token, Password"`
+		Token string
+	}
+
+	err = CheckStruct(&missingStruct{Token: "token"})
+	if err == nil || !strings.Contains(err.Error(), "field Password referenced by field _ does not exist") {
+		t.Errorf("Group member that does not exist was not detected: %v", err)
+	}
+}
+
+// Test atleastone, fields set by default values count as set
+func TestAtLeastOne(t *testing.T) {
+
+	type testStruct struct {
+		_      struct{} `atleastone:"Host, Socket"`
+		Host   string
+		Port   int `default:"8080"`
+		Socket string
+	}
+
+	test := testStruct{}
+	err := CheckStruct(&test)
+	if err == nil {
+		t.Errorf("At least one constraint with no fields set was not detected")
+	}
+
+	type defaultStruct struct {
+		_      struct{} `atleastone:"Host, Socket"`
+		Host   string   `default:"localhost"`
+		Socket string
+	}
+
+	test2 := defaultStruct{}
+	err = CheckStruct(&test2)
+	if err != nil {
+		t.Errorf("At least one constraint satisfied by default value should be valid: %s", err)
+	}
+}
+
+// Test atmostone with custom error message
+func TestAtMostOne(t *testing.T) {
+
+	type testStruct struct {
+		_    struct{} `atmostone:"File, URL" errormsg:"only one source may be given"`
+		File string
+		URL  string
+	}
+
+	test := testStruct{File: "config.json", URL: "http://localhost"}
+	err := CheckStruct(&test)
+	if err == nil {
+		t.Fatalf("At most one constraint with two fields set was not detected")
+	}
+	if err.Error() != "only one source may be given" {
+		t.Errorf("Custom error message not returned correctly. Got: %s", err.Error())
+	}
+
+	test = testStruct{}
+	err = CheckStruct(&test)
+	if err != nil {
+		t.Errorf("At most one constraint with no fields set should be valid: %s", err)
+	}
+}
+
+// Test numeric cross-field comparisons
+func TestCompareFields(t *testing.T) {
+
+	type testStruct struct {
+		MinConns int `ltefield:"MaxConns"`
+		MaxConns int `default:"10"`
+	}
+
+	test := testStruct{MinConns: 20}
+	err := CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Field greater than compared field was not detected")
+	}
+
+	test = testStruct{MinConns: 10}
+	err = CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Field equal to compared field should be valid: %s", err)
+	}
+}
+
+// Test durations compared with a field in a nested struct
+func TestCompareFieldsDurationNested(t *testing.T) {
+
+	type timeouts struct {
+		Write time.Duration `default:"10"`
+	}
+	type testStruct struct {
+		Read     time.Duration `ltfield:"Timeouts.Write"`
+		Timeouts timeouts
+	}
+
+	test := testStruct{Read: 5}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Duration less than compared nested field should be valid: %s", err)
+	}
+
+	test = testStruct{Read: 10 * time.Second}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Duration greater than compared nested field was not detected")
+	}
+}
+
+// Test string cross-field comparisons
+func TestCompareFieldsString(t *testing.T) {
+
+	type testStruct struct {
+		Password string
+		Confirm  string `eqfield:"Password"`
+		Old      string `nefield:"Password"`
+	}
+
+	test := testStruct{Password: "secret", Confirm: "secret", Old: "other"}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Equal string fields should be valid: %s", err)
+	}
+
+	test = testStruct{Password: "secret", Confirm: "secret", Old: "secret"}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Equal string fields tagged nefield was not detected")
+	}
+}
+
+// Test comparisons with Optional fields, unset Optional fields on either side are not compared
+func TestCompareFieldsOptional(t *testing.T) {
+
+	type testStruct struct {
+		Min Optional[int] `ltefield:"Max"`
+		Max Optional[int]
+	}
+
+	test := testStruct{Min: Some(5)}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Comparison with unset Optional field should be skipped: %s", err)
+	}
+
+	test = testStruct{Min: Some(5), Max: Some(0)}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Field greater than set Optional field with zero value was not detected")
+	}
+}
+
+// Test comparison of incompatible types and missing fields
+func TestCompareFieldsInvalid(t *testing.T) {
+
+	type incompatible struct {
+		Val   int `gtfield:"Other"`
+		Other string
+	}
+
+	test := incompatible{Val: 1, Other: "1"}
+	err := CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Comparison of incompatible types was not detected")
+	}
+
+	type missing struct {
+		Val int `gtefield:"Missing"`
+	}
+
+	test2 := missing{Val: 1}
+	err = CheckStruct(&test2)
+	if err == nil {
+		t.Errorf("Comparison with missing field was not detected")
+	}
+}
+
+type hookBackend struct {
+	Host string
+	Port int `default:"80"`
+}
+
+func (b *hookBackend) SetDefaults() {
+	if b.Host == "" {
+		b.Host = "localhost"
+	}
+}
+
+func (b *hookBackend) Validate() error {
+	if b.Host == "localhost" && b.Port == 443 {
+		return errors.New("localhost can not use port 443")
+	}
+	return nil
+}
+
+type hookConfig struct {
+	Name     string
+	Backend  hookBackend
+	Backends []hookBackend
+}
+
+func (c hookConfig) Validate() error {
+	if c.Name == "invalid" {
+		return errors.New("name is invalid")
+	}
+	return nil
+}
+
+// Test Defaulter and Validator interface hooks on nested structs and slices of structs
+func TestValidatorAndDefaulter(t *testing.T) {
+
+	test := hookConfig{
+		Name:     "test",
+		Backends: []hookBackend{{Port: 8080}},
+	}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if test.Backend.Host != "localhost" || test.Backends[0].Host != "localhost" {
+		t.Errorf("SetDefaults was not called on nested structs")
+	}
+	if test.Backend.Port != 80 {
+		t.Errorf("Annotations were not processed after SetDefaults")
+	}
+
+	test = hookConfig{Backends: []hookBackend{{Port: 8080}, {Port: 443}}}
+	err = CheckStruct(&test)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("Validate error in slice element was not returned as FieldError: %v", err)
+	}
+	if fieldErr.Path != "Backends[1]" {
+		t.Errorf("Validate error not attributed to struct path. Wanted 'Backends[1]', got '%s'", fieldErr.Path)
+	}
+
+	test = hookConfig{Name: "invalid"}
+	err = CheckStruct(&test)
+	if err == nil || err.Error() != "name is invalid" {
+		t.Errorf("Validate error on root struct not returned correctly. Got: %v", err)
+	}
+}
+
+func init() {
+	_ = RegisterValidator("region", func(v reflect.Value, param string) error {
+		if !slices.Contains([]string{"eu-north-1", "us-east-1"}, v.String()) {
+			return fmt.Errorf("unknown region %s", v.String())
+		}
+		return nil
+	}, reflect.String)
+	_ = RegisterValidator("tenant", func(v reflect.Value, param string) error {
+		if v.String() != param {
+			return fmt.Errorf("tenant must be %s", param)
+		}
+		return nil
+	})
+}
+
+// Test named validators on fields and slice elements
+func TestNamedValidators(t *testing.T) {
+
+	type testStruct struct {
+		Region  string   `validate:"region"`
+		Regions []string `validate:"region"`
+		Tenant  string   `validate:"tenant=prod"`
+	}
+
+	test := testStruct{Region: "eu-north-1", Regions: []string{"us-east-1"}, Tenant: "prod"}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Valid values failed named validators: %s", err)
+	}
+
+	test = testStruct{Regions: []string{"us-east-1", "mars-1"}}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Invalid slice element was not detected by named validator")
+	}
+
+	test = testStruct{Tenant: "dev"}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Named validator parameter was not applied")
+	}
+}
+
+// Test registration errors and unknown validators
+func TestRegisterValidatorErrors(t *testing.T) {
+
+	err := RegisterValidator("region", func(v reflect.Value, param string) error { return nil })
+	if err == nil {
+		t.Errorf("Duplicate validator registration was not detected")
+	}
+	err = RegisterValidator("not valid", func(v reflect.Value, param string) error { return nil })
+	if err == nil {
+		t.Errorf("Invalid validator name was not detected")
+	}
+	err = RegisterValidator("nilfunc", nil)
+	if err == nil {
+		t.Errorf("Nil validator function was not detected")
+	}
+
+	type testStruct struct {
+		Val string `validate:"unknown"`
+	}
+	test := testStruct{}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Unknown validator was not detected")
+	}
+
+	// Validators registered for strings reject other kinds, slices are validated per element
+	type kindStruct struct {
+		Regions Optional[[]string] `validate:"region"`
+		Ports   []int              `validate:"region"`
+	}
+	err = CheckStruct(&kindStruct{Ports: []int{80}})
+	if err == nil || !strings.Contains(err.Error(), "validator region does not accept values of type int") {
+		t.Errorf("Validator applied to a field of a kind it does not accept was not detected: %v", err)
+	}
+}
+
+// Test assertions with arithmetic, boolean logic and nested field access
+func TestAssert(t *testing.T) {
+
+	type tls struct {
+		Enabled bool
+	}
+	type testStruct struct {
+		_        struct{} `assert:"MaxConns >= MinConns && (TLS.Enabled || Port != 443)"`
+		MinConns int
+		MaxConns int `default:"10"`
+		Port     int
+		TLS      tls
+	}
+
+	test := testStruct{MinConns: 5, Port: 443, TLS: tls{Enabled: true}}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Valid assertion failed: %s", err)
+	}
+
+	test = testStruct{MinConns: 20}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Failing assertion was not detected")
+	}
+
+	test = testStruct{Port: 443}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Failing assertion on nested field was not detected")
+	}
+}
+
+// Test assertions with len(), in lists and arithmetic
+func TestAssertFunctions(t *testing.T) {
+
+	type testStruct struct {
+		Mode    string   `assert:"Mode in ['fast', 'safe'] && len(Hosts) * 2 <= Limit - 1"`
+		Hosts   []string `default:"{a, b}"`
+		Limit   float64  `default:"5"`
+		Enabled bool
+	}
+
+	test := testStruct{Mode: "fast"}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Valid assertion failed: %s", err)
+	}
+
+	test = testStruct{Mode: "slow"}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Value not in list was not detected")
+	}
+
+	test = testStruct{Mode: "safe", Hosts: []string{"a", "b", "c"}}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Failing len() assertion was not detected")
+	}
+}
+
+// Test invalid assertions
+func TestAssertInvalid(t *testing.T) {
+
+	type unknownField struct {
+		_ struct{} `assert:"Missing > 1"`
+	}
+	err := CheckStruct(&unknownField{})
+	if err == nil {
+		t.Errorf("Assertion referencing unknown field was not detected")
+	}
+
+	type syntaxError struct {
+		_   struct{} `assert:"Val > (1"`
+		Val int
+	}
+	err = CheckStruct(&syntaxError{})
+	if err == nil {
+		t.Errorf("Assertion with syntax error was not detected")
+	}
+
+	type notBoolean struct {
+		_   struct{} `assert:"Val + 1"`
+		Val int
+	}
+	err = CheckStruct(&notBoolean{})
+	if err == nil {
+		t.Errorf("Assertion not evaluating to a boolean was not detected")
+	}
+}
+
+// Test that explicitly set zero values in Optional fields are kept
+func TestOptional(t *testing.T) {
+
+	type nestedStruct struct {
+		Enabled Optional[bool] `default:"true"`
+	}
+	type testStruct struct {
+		Port    Optional[int] `required:"true" validrange:"0-100"`
+		Name    Optional[string]
+		Items   []nestedStruct
+		Timeout Optional[int] `default:"30" requires:"Name"`
+	}
+
+	test := testStruct{
+		Port:    Some(0),
+		Items:   []nestedStruct{{Enabled: Some(false)}, {}},
+		Timeout: Some(0),
+	}
+	err := CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Optional field requiring unset Optional field was not detected")
+	}
+
+	test.Name.Set("")
+	err = CheckStruct(&test)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if port, set := test.Port.Get(); !set || port != 0 {
+		t.Errorf("Required Optional field with zero value was not kept")
+	}
+	if test.Timeout.Value() != 0 {
+		t.Errorf("Default overwrote explicitly set Optional zero value. Got %d", test.Timeout.Value())
+	}
+	if test.Items[0].Enabled.Value() != false {
+		t.Errorf("Default overwrote explicitly set Optional false value")
+	}
+	if !test.Items[1].Enabled.IsSet() || test.Items[1].Enabled.Value() != true {
+		t.Errorf("Default was not applied to unset Optional field")
+	}
+
+	test = testStruct{}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Unset required Optional field was not detected")
+	}
+
+	test = testStruct{Port: Some(101)}
+	err = CheckStruct(&test)
+	if err == nil {
+		t.Errorf("Optional value out of range was not detected")
+	}
+}
+
+// Test that zero values provided by environment variables are kept
+func TestEnvVarZeroValuePresence(t *testing.T) {
+
+	type testStruct struct {
+		Enabled bool   `env:"DEFCON_TEST_ENABLED" default:"true"`
+		Port    int    `env:"DEFCON_TEST_PORT" required:"true"`
+		Name    string `requires:"Port"`
+	}
+
+	t.Setenv("DEFCON_TEST_ENABLED", "false")
+	t.Setenv("DEFCON_TEST_PORT", "0")
+
+	test := testStruct{Name: "test"}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Errorf("Zero values from environment variables should be valid: %s", err)
+	}
+	if test.Enabled != false {
+		t.Errorf("Default overwrote false value from environment variable")
+	}
+}
+
+// Test that defaultfrom takes the value of the other field after its defaults and environment variables have been applied, regardless of declaration order
+func TestDefaultFrom(t *testing.T) {
+
+	type testStruct struct {
+		AdminHost  string `defaultfrom:"ListenHost"`
+		AdminPort  int    `defaultfrom:"ListenPort" default:"9090"`
+		ProxyHost  string `defaultfrom:"ListenHost" env:"DEFCON_TEST_PROXY_HOST"`
+		ListenHost string `default:"0.0.0.0"`
+		ListenPort int    `env:"DEFCON_TEST_LISTEN_PORT"`
+		TLS        struct {
+			Host string `default:"tls.local"`
+		}
+		TLSHost string `defaultfrom:"TLS.Host"`
+	}
+
+	t.Setenv("DEFCON_TEST_PROXY_HOST", "proxy.local")
+
+	test := testStruct{}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if test.AdminHost != "0.0.0.0" || test.TLSHost != "tls.local" {
+		t.Errorf("defaultfrom did not take the default of the other field: %+v", test)
+	}
+	if test.AdminPort != 9090 {
+		t.Errorf("Default was not used as fallback for an unset field. Got %d", test.AdminPort)
+	}
+	if test.ProxyHost != "proxy.local" {
+		t.Errorf("Environment variable did not take precedence over defaultfrom. Got '%s'", test.ProxyHost)
+	}
+
+	t.Setenv("DEFCON_TEST_LISTEN_PORT", "8080")
+	test = testStruct{AdminHost: "admin.local"}
+	err = CheckStruct(&test)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if test.AdminPort != 8080 {
+		t.Errorf("defaultfrom did not take the environment variable of the other field. Got %d", test.AdminPort)
+	}
+	if test.AdminHost != "admin.local" {
+		t.Errorf("defaultfrom overwrote a set field. Got '%s'", test.AdminHost)
+	}
+
+	type mismatch struct {
+		Port int `defaultfrom:"Host"`
+		Host string
+	}
+	err = CheckStruct(&mismatch{Host: "a"})
+	if err == nil {
+		t.Errorf("defaultfrom between fields of different types was not detected")
+	}
+}
+
+// Test defaultfrom between Optional and plain fields, Optional fields are unwrapped on both sides
+func TestDefaultFromOptional(t *testing.T) {
+
+	type testStruct struct {
+		Port       Optional[int] `defaultfrom:"ListenPort"`
+		Debug      bool          `defaultfrom:"Verbose"`
+		Level      int           `defaultfrom:"Verbosity" default:"3"`
+		Timeout    Optional[int] `defaultfrom:"MaxTimeout"`
+		ListenPort int           `default:"8080"`
+		Verbose    Optional[bool]
+		Verbosity  Optional[int]
+		MaxTimeout Optional[int]
+	}
+
+	test := testStruct{Verbose: Some(true), MaxTimeout: Some(0)}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if port, set := test.Port.Get(); !set || port != 8080 {
+		t.Errorf("Optional field did not take its default from a plain field. Got %d, set %t", port, set)
+	}
+	if !test.Debug {
+		t.Errorf("Plain field did not take its default from an Optional field")
+	}
+	if test.Level != 3 {
+		t.Errorf("Unset Optional field was taken as default. Got %d", test.Level)
+	}
+	if timeout, set := test.Timeout.Get(); !set || timeout != 0 {
+		t.Errorf("Optional field did not take the zero value of a set Optional field. Got %d, set %t", timeout, set)
+	}
+
+	// Set Optional fields are kept, even with zero values
+	test = testStruct{Port: Some(0)}
+	err = CheckStruct(&test)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if port, set := test.Port.Get(); !set || port != 0 {
+		t.Errorf("defaultfrom overwrote a set Optional field. Got %d", port)
+	}
+}
+
+// Test provenance report
+func TestReport(t *testing.T) {
+
+	type backend struct {
+		Host string `default:"localhost"`
+	}
+	type testStruct struct {
+		DBHost     string   `env:"DEFCON_TEST_DB_HOST"`
+		ListenHost string   `default:"0.0.0.0"`
+		AdminHost  string   `defaultfrom:"ListenHost"`
+		Name       string   `default:"unused"`
+		Tags       []string `alwayshas:"base"`
+		Unset      int
+		Backends   []backend
+	}
+
+	t.Setenv("DEFCON_TEST_DB_HOST", "db.local")
+
+	test := testStruct{Name: "preset", Backends: []backend{{}}}
+	report := Report{}
+	err := CheckStruct(&test, WithReport(&report))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"DBHost":           "env:DEFCON_TEST_DB_HOST",
+		"ListenHost":       "default",
+		"AdminHost":        "defaultfrom:ListenHost",
+		"Name":             "preset",
+		"Tags":             "alwayshas",
+		"Unset":            "unset",
+		"Backends[0].Host": "default",
+	}
+	for path, source := range expected {
+		field, found := report.Get(path)
+		if !found {
+			t.Errorf("Field %s missing from report", path)
+			continue
+		}
+		if field.Source != source {
+			t.Errorf("Wrong source for field %s. Wanted '%s', got '%s'", path, source, field.Source)
+		}
+	}
+
+	field, _ := report.Get("DBHost")
+	if field.Raw != "db.local" || field.Value != "db.local" {
+		t.Errorf("Wrong raw or final value in report. Got raw '%s' and value '%v'", field.Raw, field.Value)
+	}
+	if test.AdminHost != "0.0.0.0" {
+		t.Errorf("defaultfrom did not set value from other field. Got '%s'", test.AdminHost)
+	}
+	if len(report.Fields) != len(expected) {
+		t.Errorf("Unexpected number of fields in report. Wanted %d, got %d", len(expected), len(report.Fields))
+	}
+}
+
+// Test redacting secrets in reports, secret structs redact all of their fields
+func TestReportSecrets(t *testing.T) {
+
+	type credentials struct {
+		User     string `default:"admin"`
+		Password string `env:"DEFCON_TEST_SECRET_PASSWORD"`
+	}
+	type testStruct struct {
+		Token       string      `env:"DEFCON_TEST_SECRET_TOKEN" secret:"true"`
+		Key         string      `secret:"true"`
+		Credentials credentials `secret:"true"`
+		Host        string      `default:"localhost"`
+	}
+
+	t.Setenv("DEFCON_TEST_SECRET_TOKEN", "hunter2")
+	t.Setenv("DEFCON_TEST_SECRET_PASSWORD", "hunter3")
+
+	test := testStruct{Key: "hunter4"}
+	report := Report{}
+	err := CheckStruct(&test, WithReport(&report))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if out := report.String(); strings.Contains(out, "hunter") || strings.Contains(out, "admin") {
+		t.Errorf("Secret values were not redacted:\n%s", out)
+	}
+	for path, expected := range map[string]FieldSource{
+		"Token":                {Path: "Token", Source: "env:DEFCON_TEST_SECRET_TOKEN", Raw: Redacted, Value: Redacted},
+		"Key":                  {Path: "Key", Source: SourcePreset, Value: Redacted},
+		"Credentials.User":     {Path: "Credentials.User", Source: SourceDefault, Raw: Redacted, Value: Redacted},
+		"Credentials.Password": {Path: "Credentials.Password", Source: "env:DEFCON_TEST_SECRET_PASSWORD", Raw: Redacted, Value: Redacted},
+		"Host":                 {Path: "Host", Source: SourceDefault, Raw: "localhost", Value: "localhost"},
+	} {
+		field, _ := report.Get(path)
+		if field != expected {
+			t.Errorf("Unexpected report of field %s. Wanted %+v, got %+v", path, expected, field)
+		}
+	}
+	if test.Token != "hunter2" || test.Credentials.Password != "hunter3" {
+		t.Errorf("Redaction altered the config: %+v", test)
+	}
+}
+
+// Test redacting report values of pointers to structs and maps of structs holding secrets
+func TestReportNestedSecrets(t *testing.T) {
+
+	type credentials struct {
+		User     string
+		Password string `secret:"true"`
+	}
+	type testStruct struct {
+		Primary  *credentials
+		Unset    *credentials
+		Accounts map[string]credentials
+		Names    map[string]string
+	}
+
+	test := testStruct{
+		Primary:  &credentials{User: "admin", Password: "hunter1"},
+		Accounts: map[string]credentials{"a": {User: "alice", Password: "hunter2"}},
+		Names:    map[string]string{"a": "alice"},
+	}
+	report := Report{}
+	err := CheckStruct(&test, WithReport(&report))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if out := report.String(); strings.Contains(out, "hunter") {
+		t.Errorf("Secret values were not redacted:\n%s", out)
+	}
+	for path, expected := range map[string]any{"Primary": Redacted, "Unset": (*credentials)(nil), "Accounts": Redacted} {
+		field, _ := report.Get(path)
+		if field.Value != expected {
+			t.Errorf("Unexpected report value of field %s. Wanted %v, got %v", path, expected, field.Value)
+		}
+	}
+	if field, _ := report.Get("Names"); !reflect.DeepEqual(field.Value, test.Names) {
+		t.Errorf("Map without secrets was redacted: %v", field.Value)
+	}
+}
+
+// Test dumping a config as a table, JSON and YAML with redacted secrets
+func TestDump(t *testing.T) {
+
+	type database struct {
+		Host     string `env:"DB_HOST" default:"localhost"`
+		Password string `secret:"true"`
+	}
+	type testStruct struct {
+		Name     string
+		Ports    []int `default:"{80, 443}"`
+		Database database
+		Replicas []database
+	}
+
+	test := testStruct{Name: "test", Database: database{Password: "hunter2"}, Replicas: []database{{Host: "replica"}}}
+	err := CheckStruct(&test)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, format := range []Format{FormatTable, FormatJSON, FormatYAML} {
+		var b strings.Builder
+		err = Dump(&b, &test, format)
+		if err != nil {
+			t.Fatalf("Dump in format %s failed: %s", format, err)
+		}
+		out := b.String()
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("Secret value was not redacted in format %s", format)
+		}
+		for _, expected := range []string{"Database.Host", "Replicas[0].Host", "replica", "DB_HOST", Redacted} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("Dump in format %s does not contain '%s':\n%s", format, expected, out)
+			}
+		}
+	}
+
+	var b strings.Builder
+	err = Dump(&b, &test, FormatJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	var entries []map[string]any
+	err = json.Unmarshal([]byte(b.String()), &entries)
+	if err != nil {
+		t.Fatalf("Dump did not produce valid JSON: %s", err)
+	}
+	if len(entries) != 6 {
+		t.Errorf("Unexpected number of fields in dump. Wanted 6, got %d", len(entries))
+	}
+
+	err = Dump(&b, &test, Format("xml"))
+	if err == nil {
+		t.Errorf("Unsupported format was not detected")
+	}
+}
+
+// Test dumping structs held by interfaces, struct values are not addressable
+func TestDumpInterfaceValues(t *testing.T) {
+
+	type inner struct {
+		secret string `secret:"true"`
+		Name   string
+	}
+	config := struct {
+		X any
+		Y any
+	}{X: inner{secret: "hunter2", Name: "a"}, Y: &inner{secret: "hunter3", Name: "b"}}
+
+	var b strings.Builder
+	err := Dump(&b, &config, FormatTable)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if strings.Contains(b.String(), "hunter") || !strings.Contains(b.String(), "X.Name") || !strings.Contains(b.String(), "Y.Name") {
+		t.Errorf("Unexpected dump:\n%s", b.String())
+	}
+}
+
+// Test dumping secrets of structs behind pointers, in maps and in slices of pointers which are not walked
+func TestDumpNestedSecrets(t *testing.T) {
+
+	type credentials struct {
+		User     string
+		Password string `secret:"true"`
+	}
+	type testStruct struct {
+		Primary  *credentials
+		Unset    *credentials
+		Accounts map[string]credentials
+		Backups  map[string]*credentials
+		Others   []*credentials
+	}
+
+	test := testStruct{
+		Primary:  &credentials{User: "admin", Password: "hunter1"},
+		Accounts: map[string]credentials{"b": {User: "bob", Password: "hunter2"}, "a": {User: "alice", Password: "hunter3"}},
+		Backups:  map[string]*credentials{"c": {User: "carol", Password: "hunter4"}, "d": nil},
+		Others:   []*credentials{{User: "dave", Password: "hunter5"}},
+	}
+
+	for _, format := range []Format{FormatTable, FormatJSON, FormatYAML} {
+		var b strings.Builder
+		err := Dump(&b, &test, format)
+		if err != nil {
+			t.Fatalf("Dump in format %s failed: %s", format, err)
+		}
+		out := b.String()
+		if strings.Contains(out, "hunter") || strings.Contains(out, "dave") {
+			t.Errorf("Secret values were not redacted in format %s:\n%s", format, out)
+		}
+		for _, expected := range []string{"Primary.User", "admin", "Accounts[a].User", "alice", "Accounts[b].Password", "Backups[c].User", "carol", "Backups[d]", "Others"} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("Dump in format %s does not contain '%s':\n%s", format, expected, out)
+			}
+		}
+		if strings.Index(out, "Accounts[a]") > strings.Index(out, "Accounts[b]") {
+			t.Errorf("Map elements were not dumped in the order of their keys:\n%s", out)
+		}
+	}
+}
+
+// Test that dumping a config with pointer cycles stops at structs that are already dumped
+func TestDumpCycles(t *testing.T) {
+
+	type node struct {
+		Name     string `secret:"true"`
+		Next     *node
+		Previous any
+	}
+
+	test := &node{Name: "first"}
+	test.Next = &node{Name: "second", Next: test, Previous: test}
+	test.Previous = test.Next
+
+	for _, format := range []Format{FormatTable, FormatJSON, FormatYAML} {
+		var b strings.Builder
+		err := Dump(&b, test, format)
+		if err != nil {
+			t.Fatalf("Dump in format %s failed: %s", format, err)
+		}
+		out := b.String()
+		if !strings.Contains(out, "Next.Name") || strings.Contains(out, "Next.Next") || strings.Contains(out, "Previous.Name") {
+			t.Errorf("Dump in format %s did not stop at pointer cycles:\n%s", format, out)
+		}
+		if strings.Contains(out, "first") || strings.Contains(out, "second") {
+			t.Errorf("Secret values were not redacted in format %s:\n%s", format, out)
+		}
+	}
+}
+
+// Test generating documentation for a config struct
+func TestGenerateDocs(t *testing.T) {
+
+	type backend struct {
+		Host string `env:"BACKEND_HOST" mustmatch:"^[a-z.]+$" desc:"Backend host"`
+	}
+	type testStruct struct {
+		Port     int    `env:"PORT" default:"8080" required:"true" validrange:"1-65535" desc:"Port to listen on"`
+		Password string `default:"changeme" secret:"true"`
+		Backends []backend
+	}
+
+	docs, err := GenerateDocs(&testStruct{}, FormatMarkdown)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, expected := range []string{"| `Port` | `int` | `PORT` | `8080` | yes | `1-65535` |  | Port to listen on |", "`Backends[].Host`", "`^[a-z.]+$`", "[REDACTED]"} {
+		if !strings.Contains(docs, expected) {
+			t.Errorf("Markdown documentation does not contain '%s':\n%s", expected, docs)
+		}
+	}
+	if strings.Contains(docs, "changeme") {
+		t.Errorf("Default value of secret field was not redacted")
+	}
+
+	docs, err = GenerateDocs(testStruct{}, FormatHTML)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(docs, "<td><code>Backends[].Host</code></td>") || !strings.Contains(docs, "<td>Backend host</td>") {
+		t.Errorf("HTML documentation not generated correctly:\n%s", docs)
+	}
+
+	_, err = GenerateDocs(1, FormatMarkdown)
+	if err == nil {
+		t.Errorf("Non-struct config was not detected")
+	}
+}
+
+type schemaBackend struct {
+	Host string `required:"true" mustmatch:"^[a-z.]+$"`
+	Port int    `default:"80" validrange:"1-65535"`
+}
+
+// Test JSON Schema generation
+func TestJSONSchema(t *testing.T) {
+
+	type testStruct struct {
+		Name     string             `json:"name" required:"true" desc:"Name of the service"`
+		Ports    []int              `default:"{80, 443}" validrange:"80, 443, 8000-9000" unique:"true"`
+		Tags     []string           `alwayshas:"base"`
+		Level    Optional[int]      `validrange:"1, 2, 3"`
+		Hosts    Optional[[]string] `musthave:"a" alwayshas:"b"`
+		Started  time.Time
+		Stopped  Optional[time.Time]
+		Fallback Optional[schemaBackend] `desc:"Used if Backend is down"`
+		Backend  schemaBackend           `required:"true"`
+		Backends []schemaBackend
+		Ignored  string `json:"-"`
+		internal string
+	}
+
+	out, err := JSONSchema(&testStruct{internal: "x"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	var schema map[string]any
+	err = json.Unmarshal(out, &schema)
+	if err != nil {
+		t.Fatalf("Schema is not valid JSON: %s", err)
+	}
+
+	expected := map[string]any{
+		"$schema":                                     "https://json-schema.org/draft/2020-12/schema",
+		"required":                                    []any{"name", "Backend"},
+		"properties.name.description":                 "Name of the service",
+		"properties.Ports.default":                    []any{float64(80), float64(443)},
+		"properties.Ports.uniqueItems":                true,
+		"properties.Ports.items.anyOf":                []any{map[string]any{"minimum": float64(8000), "maximum": float64(9000)}, map[string]any{"enum": []any{float64(80), float64(443)}}},
+		"properties.Tags.contains.const":              "base",
+		"properties.Level.enum":                       []any{float64(1), float64(2), float64(3), nil},
+		"properties.Level.type":                       []any{"integer", "null"},
+		"properties.Hosts.type":                       []any{"array", "null"},
+		"properties.Started.type":                     "string",
+		"properties.Started.format":                   "date-time",
+		"properties.Stopped.type":                     []any{"string", "null"},
+		"properties.Fallback.anyOf":                   []any{map[string]any{"$ref": "#/$defs/schemaBackend"}, map[string]any{"type": "null"}},
+		"properties.Fallback.description":             "Used if Backend is down",
+		"properties.Hosts.allOf":                      []any{map[string]any{"contains": map[string]any{"const": "a"}}, map[string]any{"contains": map[string]any{"const": "b"}}},
+		"properties.Backend.$ref":                     "#/$defs/schemaBackend",
+		"properties.Backends.items.$ref":              "#/$defs/schemaBackend",
+		"$defs.schemaBackend.required":                []any{"Host"},
+		"$defs.schemaBackend.properties.Host.pattern": "^[a-z.]+$",
+		"$defs.schemaBackend.properties.Port.anyOf":   []any{map[string]any{"minimum": float64(1), "maximum": float64(65535)}, map[string]any{"enum": []any{float64(0)}}},
+		"$defs.schemaBackend.properties.Port.default": float64(80),
+	}
+	for path, value := range expected {
+		var current any = schema
+		for _, key := range strings.Split(path, ".") {
+			current = current.(map[string]any)[key]
+		}
+		if !reflect.DeepEqual(current, value) {
+			t.Errorf("Unexpected value at %s. Wanted %v, got %v", path, value, current)
+		}
+	}
+
+	properties := schema["properties"].(map[string]any)
+	if _, found := properties["Ignored"]; found {
+		t.Errorf("Field with json:\"-\" tag was included in schema")
+	}
+	if _, found := properties["internal"]; found {
+		t.Errorf("Unexported field was included in schema")
+	}
+}
+
+// Test that the schema accepts config files which CheckStruct accepts, i.e. missing fields it fills in and zero values it treats as unset
+func TestJSONSchemaUnsetValues(t *testing.T) {
+
+	type testStruct struct {
+		Name     string        `required:"true"`
+		Region   string        `required:"true" default:"eu"`
+		Token    string        `required:"true" env:"TOKEN"`
+		Zone     string        `required:"true" defaultfrom:"Region"`
+		Port     int           `validrange:"1-65535"`
+		Level    int           `validrange:"1, 2"`
+		Offset   int           `validrange:"-5-5"`
+		Pair     [2]int        `validrange:"1-10"`
+		Ports    []int         `validrange:"1-10"`
+		Priority Optional[int] `validrange:"1-10"`
+	}
+
+	out, err := JSONSchema(&testStruct{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	var schema map[string]any
+	err = json.Unmarshal(out, &schema)
+	if err != nil {
+		t.Fatalf("Schema is not valid JSON: %s", err)
+	}
+
+	properties := schema["properties"].(map[string]any)
+	expected := map[string]any{
+		"required":                       []any{"Name"},
+		"properties.Port.anyOf":          []any{map[string]any{"minimum": float64(1), "maximum": float64(65535)}, map[string]any{"enum": []any{float64(0)}}},
+		"properties.Level.enum":          []any{float64(1), float64(2), float64(0)},
+		"properties.Offset.minimum":      float64(-5),
+		"properties.Pair.items.anyOf":    []any{map[string]any{"minimum": float64(1), "maximum": float64(10)}, map[string]any{"enum": []any{float64(0)}}},
+		"properties.Ports.items.minimum": float64(1),
+		"properties.Priority.minimum":    float64(1),
+	}
+	for path, value := range expected {
+		var current any = schema
+		for _, key := range strings.Split(path, ".") {
+			current = current.(map[string]any)[key]
+		}
+		if !reflect.DeepEqual(current, value) {
+			t.Errorf("Unexpected value at %s. Wanted %v, got %v", path, value, current)
+		}
+	}
+	if _, found := properties["Offset"].(map[string]any)["anyOf"]; found {
+		t.Errorf("0 was added to a range containing it: %v", properties["Offset"])
+	}
+
+	// The schema agrees with CheckStruct on zero values
+	c := testStruct{Name: "a", Token: "b"}
+	err = CheckStruct(&c, WithLookupEnv(func(string) (string, bool) { return "", false }))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	err = CheckStruct(&testStruct{Name: "a", Token: "b", Ports: []int{0}})
+	if err == nil {
+		t.Errorf("Zero element of slice was not checked against the range")
+	}
+}
+
+type EnvTestConfig struct {
+	Host     string `env:"HOST" default:"localhost" desc:"Host to connect to"`
+	Token    string `env:"TOKEN" required:"true" secret:"true"`
+	Retries  int    `env:"RETRIES"`
+	Internal string
+}
+
+// Test generating example environments
+func TestGenerateEnv(t *testing.T) {
+
+	out, err := GenerateEnv(&EnvTestConfig{}, FormatDotEnv)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "# Host (string)\n# Host to connect to\nHOST=localhost\n\n# Token (string)\n# Required\n# Secret\nTOKEN=\n\n# Retries (int)\nRETRIES=\n"
+	if out != expected {
+		t.Errorf("Unexpected .env.example. Wanted:\n%s\nGot:\n%s", expected, out)
+	}
+
+	out, err = GenerateEnv(&EnvTestConfig{}, FormatConfigMap)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(out, "  name: env-test-config\n") || strings.Contains(out, "TOKEN") {
+		t.Errorf("Unexpected ConfigMap:\n%s", out)
+	}
+
+	out, err = GenerateEnv(&EnvTestConfig{}, FormatKubernetesEnv)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(out, "secretKeyRef:\n        name: env-test-config\n        key: TOKEN\n") {
+		t.Errorf("Unexpected Kubernetes env:\n%s", out)
+	}
+}
+
+type CheckerTestConfig struct {
+	Host    string `default:"localhost"`
+	checked bool
+}
+
+// DefconCheck stands in for a method generated by defcon-gen
+func (c *CheckerTestConfig) DefconCheck() error {
+	c.checked = true
+	if c.Host == "" {
+		c.Host = "generated"
+	}
+	return nil
+}
+
+// Test that generated check methods are used instead of reflection
+func TestChecker(t *testing.T) {
+
+	config := CheckerTestConfig{}
+	err := CheckStruct(&config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !config.checked || config.Host != "generated" {
+		t.Errorf("Generated check was not used: %+v", config)
+	}
+
+	// Reports require reflection
+	config = CheckerTestConfig{}
+	report := Report{}
+	err = CheckStruct(&config, WithReport(&report))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config.checked || config.Host != "localhost" {
+		t.Errorf("Reflection was not used when a report was requested: %+v", config)
+	}
+
+	// Generated checks process unexported fields
+	config = CheckerTestConfig{}
+	err = CheckStruct(&config, WithSkipUnexported())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config.checked || config.Host != "localhost" {
+		t.Errorf("Reflection was not used when unexported fields are skipped: %+v", config)
+	}
+}
+
+// Test parsing list values
+func TestParseList(t *testing.T) {
+
+	tests := []struct {
+		value string
+		sep   string
+		want  []string
+	}{
+		{"{a, b ,c}", "", []string{"a", "b", "c"}},
+		{"a,b,c", "", []string{"a", "b", "c"}},
+		{"a\nb\n\nc\n", "", []string{"a", "b", "c"}},
+		{"a,\nb,\n", "", []string{"a", "b"}},
+		{`["a", "b,c", 1, 2.5, true]`, "", []string{"a", "b,c", "1", "2.5", "true"}},
+		{`[]`, "", []string{}},
+		{`{}`, "", []string{}},
+		{`"a, b", " c ", "", "d\"e"`, "", []string{"a, b", " c ", "", `d"e`}},
+		{`a;b, c;d`, ";", []string{"a", "b, c", "d"}},
+		{`a b  "c d"`, " ", []string{"a", "b", "c d"}},
+		{`a::b`, "::", []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		values, err := ParseList(test.value, test.sep)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.want) {
+			t.Errorf("Unexpected values for %q: %q, expected %q", test.value, values, test.want)
+		}
+	}
+
+	for _, value := range []string{`"a`, `"a" b`, `["a", {"b": 1}]`, `[a, b]`, `["a"] ["b"]`} {
+		_, err := ParseList(value, "")
+		if err == nil {
+			t.Errorf("Invalid list %q was not detected", value)
+		}
+	}
+}
+
+// Test list syntax in defaults, environment variables, musthave and alwayshas
+func TestListSyntax(t *testing.T) {
+
+	env := map[string]string{"PORTS": "[80, 443]", "HOSTS": "host1\nhost2\n"}
+	lookup := func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	}
+
+	type config struct {
+		Plain  []string `default:"a, b"`
+		JSON   []int    `env:"PORTS"`
+		Lines  []string `env:"HOSTS"`
+		Sep    []string `default:"a;b, c" sep:";" alwayshas:"d;e"`
+		Quoted []string `default:"\"x, y\", z"`
+		Must   []int    `default:"[1, 2, 3]" musthave:"{2, 3}"`
+	}
+	c := config{}
+	err := CheckStruct(&c, WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := config{
+		Plain:  []string{"a", "b"},
+		JSON:   []int{80, 443},
+		Lines:  []string{"host1", "host2"},
+		Sep:    []string{"a", "b, c", "d", "e"},
+		Quoted: []string{"x, y", "z"},
+		Must:   []int{1, 2, 3},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Unexpected values: %+v", c)
+	}
+
+	type mustHave struct {
+		Values []int `default:"{1, 2}" musthave:"2, 3"`
+	}
+	err = CheckStruct(&mustHave{})
+	if err == nil {
+		t.Errorf("Missing musthave value was not detected")
+	}
+
+	type emptySep struct {
+		Values []string `sep:""`
+	}
+	err = CheckStruct(&emptySep{})
+	if err == nil {
+		t.Errorf("Empty separator was not rejected")
+	}
+}
+
+type WatcherTestConfig struct {
+	Host  string `json:"host" required:"true"`
+	Port  int    `json:"port" validrange:"1-1024"`
+	Level int    `env:"LEVEL"`
+}
+
+// Test reloading configs when files and environment variables change
+func TestWatcher(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string, modTime time.Time) {
+		err := os.WriteFile(file, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		// Set the modification time explicitly as writes may happen within the resolution of the file system
+		err = os.Chtimes(file, modTime, modTime)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`{"host": "localhost", "port": 80}`, start)
+
+	var mu sync.Mutex
+	env := map[string]string{"LEVEL": "1"}
+	lookup := func(key string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		value, found := env[key]
+		return value, found
+	}
+
+	w, err := NewWatcher[WatcherTestConfig]([]string{file}, WithLookupEnv(lookup), WithInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	initial := w.Config()
+	if initial.Host != "localhost" || initial.Port != 80 || initial.Level != 1 {
+		t.Fatalf("Unexpected initial config: %+v", initial)
+	}
+
+	updates := w.Subscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+
+	receive := func() *WatcherTestConfig {
+		select {
+		case config := <-updates:
+			return config
+		case err := <-w.Errors():
+			t.Fatalf("Unexpected reload error: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for reload")
+		}
+		return nil
+	}
+
+	// Changed file
+	write(`{"host": "localhost", "port": 81}`, start.Add(time.Minute))
+	config := receive()
+	if config.Port != 81 || config.Level != 1 {
+		t.Errorf("Unexpected config after file change: %+v", config)
+	}
+	if initial.Port != 80 {
+		t.Errorf("Previous config was modified: %+v", initial)
+	}
+
+	// Invalid file, the last good config is kept
+	write(`{"host": "localhost", "port": 8080}`, start.Add(2*time.Minute))
+	select {
+	case err := <-w.Errors():
+		if !strings.Contains(err.Error(), "out of the specified range") {
+			t.Errorf("Unexpected reload error: %s", err)
+		}
+	case config := <-updates:
+		t.Fatalf("Invalid config was published: %+v", config)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for reload error")
+	}
+	if w.Config().Port != 81 {
+		t.Errorf("Last good config was not kept: %+v", w.Config())
+	}
+
+	// Changed environment variable
+	write(`{"host": "localhost", "port": 82}`, start.Add(3*time.Minute))
+	if config := receive(); config.Port != 82 {
+		t.Errorf("Unexpected config after fixing file: %+v", config)
+	}
+	mu.Lock()
+	env["LEVEL"] = "2"
+	mu.Unlock()
+	if config := receive(); config.Level != 2 {
+		t.Errorf("Unexpected config after environment change: %+v", config)
+	}
+
+	// Invalid initial config
+	write(`{"port": 80}`, start)
+	_, err = NewWatcher[WatcherTestConfig]([]string{file}, WithLookupEnv(lookup))
+	if err == nil {
+		t.Errorf("Invalid initial config was not detected")
+	}
+}
+
+// Test rejecting polling intervals that are not positive, time.NewTicker would panic on them
+func TestWatcherInterval(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{"host": "localhost", "port": 80}`), 0o600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		_, err = NewWatcher[WatcherTestConfig]([]string{file}, WithInterval(interval))
+		if err == nil || !strings.Contains(err.Error(), "polling interval must be positive") {
+			t.Errorf("Interval %s was not rejected: %v", interval, err)
+		}
+	}
+}
+
+type StoreTestConfig struct {
+	Name    string `default:"default"`
+	Workers int    `validrange:"1-100"`
+}
+
+// Test sharing and replacing configs concurrently
+func TestStore(t *testing.T) {
+
+	store, err := NewStore(&StoreTestConfig{Workers: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config := store.Load(); config.Name != "default" || config.Workers != 1 {
+		t.Fatalf("Unexpected initial config: %+v", config)
+	}
+
+	changes := [][2]int{}
+	store.Subscribe(func(old, new *StoreTestConfig) {
+		changes = append(changes, [2]int{old.Workers, new.Workers})
+	})
+
+	// Invalid configs are not stored
+	err = store.Swap(&StoreTestConfig{Workers: 1000})
+	if err == nil {
+		t.Errorf("Invalid config was not detected")
+	}
+	if store.Load().Workers != 1 {
+		t.Errorf("Invalid config was stored: %+v", store.Load())
+	}
+
+	// Swap while other goroutines load the config
+	var loaders, swappers sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		loaders.Add(1)
+		go func() {
+			defer loaders.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					if config := store.Load(); config.Name != "default" || config.Workers < 1 {
+						t.Errorf("Unexpected config loaded: %+v", config)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 2; i <= 100; i++ {
+		swappers.Add(1)
+		go func() {
+			defer swappers.Done()
+			err := store.Swap(&StoreTestConfig{Workers: i})
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}()
+	}
+	swappers.Wait()
+	close(done)
+	loaders.Wait()
+
+	// Every change must start from the config stored by the previous change
+	if len(changes) != 99 {
+		t.Fatalf("Unexpected number of changes. Wanted 99, got %d", len(changes))
+	}
+	previous := 1
+	for _, change := range changes {
+		if change[0] != previous {
+			t.Fatalf("Subscribers were called out of order: %v", changes)
+		}
+		previous = change[1]
+	}
+	if store.Load().Workers != previous {
+		t.Errorf("Last change does not match the stored config")
+	}
+
+	// The zero value is an empty store
+	var empty Store[StoreTestConfig]
+	if empty.Load() != nil {
+		t.Errorf("Empty store returned a config")
+	}
+}
+
+type DiffTestBackend struct {
+	Host   string
+	Weight int `reload:"live"`
+}
+
+type DiffTestConfig struct {
+	Listen   string            `reload:"restart"`
+	LogLevel string            `reload:"live"`
+	Password string            `secret:"true" reload:"live"`
+	Backends []DiffTestBackend `reload:"live"`
+	Labels   map[string]string `reload:"live"`
+	Tags     []string
+	Started  time.Time
+	timeout  int
+}
+
+// Test diffing configs
+func TestDiff(t *testing.T) {
+
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := DiffTestConfig{
+		Listen: ":8080", LogLevel: "info", Password: "old",
+		Backends: []DiffTestBackend{{Host: "a", Weight: 1}, {Host: "b", Weight: 1}},
+		Labels:   map[string]string{"env": "dev", "team": "core"},
+		Tags:     []string{"a"}, Started: started, timeout: 1,
+	}
+	new := old
+	new.LogLevel = "debug"
+	new.Password = "new"
+	new.Backends = []DiffTestBackend{{Host: "a", Weight: 2}}
+	new.Labels = map[string]string{"env": "prod", "zone": "eu"}
+	new.Started = started.In(time.FixedZone("CET", 3600)) // Same instant in another location
+	new.timeout = 2
+
+	changes := Diff(&old, new)
+	expected := []Change{
+		{Path: "LogLevel", Old: "info", New: "debug", Restart: false},
+		{Path: "Password", Old: Redacted, New: Redacted, Restart: false},
+		{Path: "Backends[0].Weight", Old: 1, New: 2, Restart: false},
+		{Path: "Backends[1]", Old: DiffTestBackend{Host: "b", Weight: 1}, New: nil, Restart: false},
+		{Path: "Labels[env]", Old: "dev", New: "prod", Restart: false},
+		{Path: "Labels[team]", Old: "core", New: nil, Restart: false},
+		{Path: "Labels[zone]", Old: nil, New: "eu", Restart: false},
+		{Path: "timeout", Old: 1, New: 2, Restart: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Unexpected changes.\nWanted: %v\nGot:    %v", expected, changes)
+	}
+	if !RequiresRestart(changes) {
+		t.Errorf("Restart was not required")
+	}
+	if RequiresRestart(changes[:7]) {
+		t.Errorf("Restart was required for live changes")
+	}
+	if changes[0].String() != `LogLevel: "info" -> "debug" (live)` {
+		t.Errorf("Unexpected string representation: %s", changes[0])
+	}
+
+	if changes := Diff(&old, &old); len(changes) != 0 {
+		t.Errorf("Unexpected changes between equal configs: %v", changes)
+	}
+
+	// A nil config is treated as the zero value
+	changes = Diff(nil, &DiffTestConfig{Listen: ":80"})
+	if len(changes) != 1 || changes[0].Path != "Listen" || changes[0].Old != "" || !changes[0].Restart {
+		t.Errorf("Unexpected changes from nil config: %v", changes)
+	}
+
+	// Invalid reload annotations are detected by CheckStruct
+	type invalidReload struct {
+		Val string `reload:"sometimes"`
+	}
+	err := CheckStruct(&invalidReload{})
+	if err == nil {
+		t.Errorf("Invalid reload annotation was not detected")
+	}
+}
+
+// Test redacting secrets of nested fields in values which are compared as a whole
+func TestDiffNestedSecrets(t *testing.T) {
+
+	type credentials struct {
+		User     string
+		Password string `secret:"true"`
+	}
+	type testStruct struct {
+		Primary  *credentials
+		Replicas []credentials
+		Accounts map[string]credentials
+		Current  any
+	}
+
+	old := testStruct{
+		Replicas: []credentials{{User: "a", Password: "hunter1"}},
+		Accounts: map[string]credentials{"a": {User: "a", Password: "hunter2"}},
+		Current:  credentials{User: "a", Password: "hunter3"},
+	}
+	new := testStruct{
+		Primary:  &credentials{User: "b", Password: "hunter4"},
+		Replicas: []credentials{{User: "a", Password: "hunter1"}, {User: "b", Password: "hunter5"}},
+		Accounts: map[string]credentials{"b": {User: "b", Password: "hunter6"}},
+		Current:  &credentials{User: "b", Password: "hunter7"},
+	}
+
+	for _, test := range []struct {
+		name     string
+		old, new testStruct
+		expected []Change
+	}{
+		{"nil to set pointer", testStruct{}, testStruct{Primary: new.Primary}, []Change{{Path: "Primary", Old: nil, New: Redacted, Restart: true}}},
+		{"set to nil pointer", testStruct{Primary: new.Primary}, testStruct{}, []Change{{Path: "Primary", Old: Redacted, New: nil, Restart: true}}},
+		{"added and removed elements", old, testStruct{Replicas: new.Replicas, Accounts: new.Accounts, Current: old.Current}, []Change{
+			{Path: "Replicas[1]", Old: nil, New: Redacted, Restart: true},
+			{Path: "Accounts[a]", Old: Redacted, New: nil, Restart: true},
+			{Path: "Accounts[b]", Old: nil, New: Redacted, Restart: true},
+		}},
+		{"interface values of different types", old, testStruct{Replicas: old.Replicas, Accounts: old.Accounts, Current: new.Current}, []Change{
+			{Path: "Current", Old: Redacted, New: Redacted, Restart: true},
+		}},
+		{"interface values of the same type", old, testStruct{Replicas: old.Replicas, Accounts: old.Accounts, Current: credentials{User: "b", Password: "hunter8"}}, []Change{
+			{Path: "Current.User", Old: "a", New: "b", Restart: true},
+			{Path: "Current.Password", Old: Redacted, New: Redacted, Restart: true},
+		}},
+	} {
+		changes := Diff(&test.old, &test.new)
+		if !reflect.DeepEqual(changes, test.expected) {
+			t.Errorf("Unexpected changes for %s.\nWanted: %v\nGot:    %v", test.name, test.expected, changes)
+		}
+		if out := fmt.Sprint(changes); strings.Contains(out, "hunter") {
+			t.Errorf("Secret values were not redacted for %s: %s", test.name, out)
+		}
+	}
+}
+
+// Test that diffing configs with pointer cycles stops at pointers that are already compared
+func TestDiffCycles(t *testing.T) {
+
+	type node struct {
+		Name     string
+		Next     *node
+		Previous any
+	}
+
+	cyclic := func(first, second string) *node {
+		n := &node{Name: first}
+		n.Next = &node{Name: second, Next: n}
+		n.Previous = n
+		return n
+	}
+
+	changes := Diff(cyclic("a", "b"), cyclic("a", "c"))
+	expected := []Change{{Path: "Next.Name", Old: "b", New: "c", Restart: true}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Unexpected changes.\nWanted: %v\nGot:    %v", expected, changes)
+	}
+}
+
+// Test loading configs with a type parameter
+func TestLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	base, override := filepath.Join(dir, "base.json"), filepath.Join(dir, "override.json")
+	for file, content := range map[string]string{base: `{"host": "localhost", "port": 80}`, override: `{"port": 81}`} {
+		err := os.WriteFile(file, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	lookup := func(key string) (string, bool) {
+		if key == "LEVEL" {
+			return "3", true
+		}
+		return "", false
+	}
+
+	config, err := Load[WatcherTestConfig](WithFiles(base, override), WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config.Host != "localhost" || config.Port != 81 || config.Level != 3 {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+
+	// Validation
+	_, err = Load[WatcherTestConfig]()
+	if err == nil {
+		t.Errorf("Missing required field was not detected")
+	}
+
+	// Missing file
+	_, err = Load[WatcherTestConfig](WithFiles(filepath.Join(dir, "missing.json")))
+	if err == nil {
+		t.Errorf("Missing file was not detected")
+	}
+
+	// Non-struct types
+	_, err = Load[*WatcherTestConfig]()
+	if err == nil {
+		t.Errorf("Pointer type was not rejected")
+	}
+	_, err = Load[string]()
+	if err == nil {
+		t.Errorf("String type was not rejected")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustLoad did not panic on invalid config")
+		}
+	}()
+	MustLoad[WatcherTestConfig]()
+}
+
+// Test defaults and environment variables for slices of structs
+func TestSliceOfStructsDefaults(t *testing.T) {
+
+	type backend struct {
+		Host   string `json:"host" required:"true"`
+		Port   int    `default:"80"`
+		Weight int    `json:"weight" validrange:"1-10"`
+	}
+	type config struct {
+		Backends []backend `default:"[{\"host\": \"a\"}, {\"host\": \"b\", \"Port\": 8080, \"weight\": 2}]"`
+		Replicas []backend `env:"REPLICAS" default:"[{\"host\": \"default\"}]"`
+		Spares   []backend `required:"true" env:"SPARES"`
+	}
+
+	env := map[string]string{"REPLICAS": `[{"host": "r1"}]`, "SPARES": `[{"host": "s1", "weight": 3}]`}
+	lookup := func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	}
+
+	c := config{}
+	err := CheckStruct(&c, WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := config{
+		Backends: []backend{{Host: "a", Port: 80}, {Host: "b", Port: 8080, Weight: 2}},
+		Replicas: []backend{{Host: "r1", Port: 80}},
+		Spares:   []backend{{Host: "s1", Port: 80, Weight: 3}},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Unexpected values: %+v", c)
+	}
+
+	// Elements are validated
+	for value, expected := range map[string]string{
+		`[{"weight": 1}]`:               "required",
+		`[{"host": "a", "weight": 11}]`: "out of the specified range",
+		`[{"host": "a", "port": "80"}]`: "cannot unmarshal",
+		`[{"host": "a", "name": "b"}]`:  "unknown field",
+		`{"host": "a"}`:                 "cannot unmarshal",
+		`[{"host": "a"}] x`:             "unexpected data",
+	} {
+		env["SPARES"] = value
+		err = CheckStruct(&config{}, WithLookupEnv(lookup))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing '%s' for %s, got %v", expected, value, err)
+		}
+	}
+}
+
+// Test fixed-size arrays
+func TestArrays(t *testing.T) {
+
+	type backend struct {
+		Host string `json:"host" required:"true"`
+		Port int    `default:"80"`
+	}
+	type config struct {
+		Names    [3]string  `default:"a, b, c" mustmatch:"^[a-z]$" unique:"true"`
+		Ports    [2]uint16  `env:"PORTS" musthave:"443"`
+		Key      [4]byte    `default:"[1, 2, 3, 4]" validate:"nonzero"`
+		Backends [2]backend `default:"[{\"host\": \"a\"}, {\"host\": \"b\", \"Port\": 8080}]"`
+		Levels   [2]int     `required:"true" validrange:"1-5"`
+	}
+	_ = RegisterValidator("nonzero", func(v reflect.Value, _ string) error {
+		if v.IsZero() {
+			return fmt.Errorf("value is zero")
+		}
+		return nil
+	})
+
+	env := map[string]string{"PORTS": "80, 443"}
+	lookup := func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	}
+
+	c := config{Levels: [2]int{1, 5}}
+	err := CheckStruct(&c, WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := config{
+		Names:    [3]string{"a", "b", "c"},
+		Ports:    [2]uint16{80, 443},
+		Key:      [4]byte{1, 2, 3, 4},
+		Backends: [2]backend{{Host: "a", Port: 80}, {Host: "b", Port: 8080}},
+		Levels:   [2]int{1, 5},
+	}
+	if c != expected {
+		t.Errorf("Unexpected values: %+v", c)
+	}
+
+	// Element level checks
+	for name, c := range map[string]config{
+		"required":   {},
+		"validrange": {Levels: [2]int{1, 6}},
+		"mustmatch":  {Names: [3]string{"a", "b", "C"}, Levels: [2]int{1, 2}},
+		"unique":     {Names: [3]string{"a", "b", "a"}, Levels: [2]int{1, 2}},
+		"musthave":   {Ports: [2]uint16{80, 8080}, Levels: [2]int{1, 2}},
+		"validate":   {Key: [4]byte{1, 0, 3, 4}, Levels: [2]int{1, 2}},
+	} {
+		err = CheckStruct(&c, WithLookupEnv(lookup))
+		if err == nil {
+			t.Errorf("Failing %s check was not detected", name)
+		}
+	}
+
+	// Defaults and environment variables must have as many elements as the array, unless padding is allowed
+	env["PORTS"] = "80"
+	err = CheckStruct(&config{Levels: [2]int{1, 2}}, WithLookupEnv(lookup))
+	if err == nil || !strings.Contains(err.Error(), "takes exactly 2 elements, got 1") {
+		t.Errorf("Too few elements were not detected: %v", err)
+	}
+	c = config{Levels: [2]int{1, 2}}
+	err = CheckStruct(&c, WithLookupEnv(lookup), WithArrayPadding())
+	if err == nil || !strings.Contains(err.Error(), "must have but has no value for field: 443") {
+		t.Errorf("Unexpected error with padding: %v", err)
+	}
+	env["PORTS"] = "[443]"
+	c = config{Levels: [2]int{1, 2}}
+	err = CheckStruct(&c, WithLookupEnv(lookup), WithArrayPadding())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.Ports != [2]uint16{443, 0} {
+		t.Errorf("Unexpected padded value: %v", c.Ports)
+	}
+	env["PORTS"] = "1, 2, 443"
+	err = CheckStruct(&config{Levels: [2]int{1, 2}}, WithLookupEnv(lookup), WithArrayPadding())
+	if err == nil || !strings.Contains(err.Error(), "takes exactly 2 elements, got 3") {
+		t.Errorf("Too many elements were not detected: %v", err)
+	}
+
+	// Zero elements, e.g. padding, are not checked against the range
+	type padded struct {
+		Levels [3]int `default:"1" validrange:"1-5"`
+		Preset [3]int `validrange:"1-5"`
+	}
+	p := padded{Preset: [3]int{1}}
+	err = CheckStruct(&p, WithArrayPadding())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if p.Levels != [3]int{1, 0, 0} {
+		t.Errorf("Unexpected padded value: %v", p.Levels)
+	}
+	err = CheckStruct(&padded{Preset: [3]int{1, 0, 6}})
+	if err == nil {
+		t.Errorf("Out of range element next to a zero element was not detected")
+	}
+
+	type alwaysHas struct {
+		Values [2]string `alwayshas:"a"`
+	}
+	err = CheckStruct(&alwaysHas{})
+	if err == nil || !strings.Contains(err.Error(), "can not be appended to arrays") {
+		t.Errorf("alwayshas on array was not rejected: %v", err)
+	}
+}
+
+// Test that inputs which used to panic are reported as errors
+func TestPanicFree(t *testing.T) {
+
+	type config struct {
+		Name string
+	}
+	var nilConfig *config
+	for name, arg := range map[string]any{
+		"nil":         nil,
+		"non-pointer": config{},
+		"nil pointer": nilConfig,
+		"non-struct":  new(string),
+	} {
+		err := CheckStruct(arg)
+		if err == nil {
+			t.Errorf("CheckStruct with %s argument did not return an error", name)
+		}
+	}
+
+	type any1 struct {
+		Value any `required:"true"`
+	}
+	err := CheckStruct(&any1{})
+	if err == nil {
+		t.Errorf("Missing required interface field was not detected")
+	}
+	err = CheckStruct(&any1{Value: 1})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	type any2 struct {
+		Value  any               `default:"1"`
+		Labels map[string]string `env:"LABELS"`
+	}
+	err = CheckStruct(&any2{})
+	if err == nil {
+		t.Errorf("Default on interface field was not rejected")
+	}
+
+	type quote struct {
+		Values []string `default:"\"abc"`
+	}
+	err = CheckStruct(&quote{})
+	if err == nil {
+		t.Errorf("List default with an unterminated quote was not rejected")
+	}
+
+	type array struct {
+		Values [2]string `alwayshas:"foo"`
+	}
+	err = CheckStruct(&array{})
+	if err == nil {
+		t.Errorf("alwayshas on array was not rejected")
+	}
+
+	type unique struct {
+		Values [][]string `unique:"true"`
+	}
+	err = CheckStruct(&unique{Values: [][]string{{"a"}, {"a"}}})
+	if err == nil {
+		t.Errorf("unique on slices of slices was not rejected")
+	}
+
+	// Named slice and element types keep their type
+	type level string
+	type levels []level
+	type named struct {
+		Levels levels   `default:"{debug, info}" alwayshas:"warn"`
+		Ports  []uint16 `default:"{80, 443}"`
+		Size   uint     `default:"10"`
+	}
+	n := named{}
+	err = CheckStruct(&n)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(n, named{Levels: levels{"debug", "info", "warn"}, Ports: []uint16{80, 443}, Size: 10}) {
+		t.Errorf("Unexpected values: %+v", n)
+	}
+}
+
+// Test that no combination of field type, annotation value and environment variable makes CheckStruct panic
+func FuzzCheckStruct(f *testing.F) {
+
+	type element struct {
+		Name string `required:"true"`
+	}
+	fieldTypes := []reflect.Type{
+		reflect.TypeFor[string](), reflect.TypeFor[int](), reflect.TypeFor[int8](), reflect.TypeFor[uint16](),
+		reflect.TypeFor[float32](), reflect.TypeFor[bool](), reflect.TypeFor[time.Duration](),
+		reflect.TypeFor[[]string](), reflect.TypeFor[[]int](), reflect.TypeFor[[]bool](), reflect.TypeFor[[3]int](),
+		reflect.TypeFor[[][]string](), reflect.TypeFor[[]element](), reflect.TypeFor[element](),
+		reflect.TypeFor[map[string]string](), reflect.TypeFor[any](), reflect.TypeFor[*int](),
+		reflect.TypeFor[Optional[int]](), reflect.TypeFor[Optional[[]string]](),
+	}
+	keys := []string{
+		"required", "default", "defaultfrom", "env", "requires", "excludes", "exactlyone", "atleastone", "atmostone",
+		"ltfield", "gtefield", "eqfield", "musthave", "unique", "alwayshas", "mustmatch", "mustnotmatch",
+		"validate", "assert", "secret", "reload", "errormsg", "validrange",
+	}
+	// Ranges are expanded to all their values, large bounds would only make the fuzzer slow
+	largeBound := regexp.MustCompile(`[0-9]{5,}`)
+
+	f.Add(uint8(0), uint8(1), "abc", "")
+	f.Add(uint8(7), uint8(1), "abc", "")
+	f.Add(uint8(7), uint8(3), "", "{a, b}")
+	f.Add(uint8(10), uint8(14), "1", "")
+	f.Add(uint8(11), uint8(13), "true", "")
+	f.Add(uint8(15), uint8(1), "1", "1")
+	f.Add(uint8(18), uint8(3), "", "{1, 2")
+	f.Add(uint8(1), uint8(18), "F > Other", "7")
+	f.Add(uint8(1), uint8(9), "Other", "")
+	f.Add(uint8(1), uint8(22), "1-10, 20", "15")
+	f.Add(uint8(10), uint8(22), "-5--1", "")
+	f.Add(uint8(8), uint8(22), "1, 2-", "{1, 3}")
+
+	f.Fuzz(func(t *testing.T, typeIndex, keyIndex uint8, value, env string) {
+		fieldType := fieldTypes[int(typeIndex)%len(fieldTypes)]
+		key := keys[int(keyIndex)%len(keys)]
+		if key == "validrange" && largeBound.MatchString(value) {
+			t.Skip()
+		}
+		tag := fmt.Sprintf(`%s:%s env:"FUZZ"`, key, strconv.Quote(value))
+		if key == "env" {
+			tag = fmt.Sprintf(`env:%s`, strconv.Quote(value))
+		}
+		configType := reflect.StructOf([]reflect.StructField{
+			{Name: "F", Type: fieldType, Tag: reflect.StructTag(tag)},
+			{Name: "Other", Type: reflect.TypeFor[int](), Tag: `default:"3"`},
+		})
+		lookup := func(string) (string, bool) {
+			return env, env != ""
+		}
+		_ = CheckStruct(reflect.New(configType).Interface(), WithLookupEnv(lookup))
+	})
+}
+
+type InlineTestTLS struct {
+	Cert string
+	Key  string `env:"TLS_KEY"`
+}
+
+func (t InlineTestTLS) Validate() error {
+	if t.Cert == "invalid" {
+		return fmt.Errorf("invalid certificate")
+	}
+	return nil
+}
+
+type InlineTestCommon struct {
+	LogLevel string `default:"info"`
+	Region   string `env:"REGION"`
+	MaxPort  int    `default:"9000"`
+}
+
+type InlineTestConfig struct {
+	InlineTestCommon
+	TLS      InlineTestTLS `defcon:"inline"`
+	Port     int           `ltfield:"MaxPort"`
+	Zone     string        `defaultfrom:"Region"`
+	Secure   bool          `requires:"Cert, Key"`
+	Listener string        `requires:"LogLevel"`
+	_        struct{}      `assert:"Port > 0 || LogLevel == \"debug\""`
+}
+
+// Test promoting fields of embedded and inline structs, their paths and references from annotations
+func TestInline(t *testing.T) {
+
+	env := map[string]string{"REGION": "eu", "TLS_KEY": ""}
+	lookup := func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	}
+
+	report := &Report{}
+	c := InlineTestConfig{Port: 8080, Secure: true, TLS: InlineTestTLS{Cert: "cert.pem"}}
+	err := CheckStruct(&c, WithLookupEnv(lookup), WithReport(report))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.LogLevel != "info" || c.Region != "eu" || c.Zone != "eu" {
+		t.Errorf("Unexpected values of promoted fields: %+v", c)
+	}
+
+	// Paths of promoted fields do not include the inline field
+	for _, path := range []string{"LogLevel", "Region", "Cert", "Key", "Zone"} {
+		if _, found := report.Get(path); !found {
+			t.Errorf("Report has no field %s: %+v", path, report.Fields)
+		}
+	}
+	if _, found := report.Get("TLS.Cert"); found {
+		t.Errorf("Report has the path of the inline field")
+	}
+
+	// Annotations referencing promoted fields
+	for name, c := range map[string]InlineTestConfig{
+		"ltfield":  {Port: 9001},
+		"requires": {Port: 1, Secure: true},
+		"assert":   {},
+	} {
+		err = CheckStruct(&c)
+		if err == nil {
+			t.Errorf("Failing %s check was not detected", name)
+		}
+	}
+
+	// Requires is checked after defaults are applied, as for fields declared by the struct itself
+	err = CheckStruct(&InlineTestConfig{Port: 1, Listener: "tcp"})
+	if err != nil {
+		t.Errorf("Promoted field set by its default was not detected: %v", err)
+	}
+
+	// Errors of inline structs have the path of the containing struct
+	var fieldErr *FieldError
+	err = CheckStruct(&InlineTestConfig{Port: 1, TLS: InlineTestTLS{Cert: "invalid"}})
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	changes := Diff(InlineTestConfig{Port: 1}, InlineTestConfig{Port: 1, InlineTestCommon: InlineTestCommon{Region: "us"}})
+	if len(changes) != 1 || changes[0].Path != "Region" {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+
+	// Fields declared by the struct shadow promoted fields
+	type shadowed struct {
+		InlineTestCommon
+		Region string
+		Name   string `requires:"Region"`
+	}
+	err = CheckStruct(&shadowed{InlineTestCommon: InlineTestCommon{Region: "eu"}, Name: "a"})
+	if err == nil {
+		t.Errorf("Promoted field was used instead of the shadowing field")
+	}
+
+	// Inline is only valid on struct fields
+	type invalidOption struct {
+		Name string `defcon:"inline"`
+	}
+	type unknownOption struct {
+		TLS InlineTestTLS `defcon:"flatten"`
+	}
+	for _, c := range []any{&invalidOption{}, &unknownOption{}} {
+		err = CheckStruct(c)
+		if err == nil {
+			t.Errorf("Invalid defcon annotation was not detected on %T", c)
+		}
+	}
+}
+
+type OneOfTestStorage interface {
+	Location() string
+}
+
+type OneOfTestS3 struct {
+	Bucket string `required:"true"`
+	Region string `default:"eu-north-1"`
+	Key    string `secret:"true"`
+}
+
+func (s *OneOfTestS3) Location() string {
+	return "s3://" + s.Bucket
+}
+
+type OneOfTestDisk struct {
+	Path string `default:"/var/lib"`
+}
+
+func (d OneOfTestDisk) Location() string {
+	return d.Path
+}
+
+type OneOfTestConfig struct {
+	Storage OneOfTestStorage `json:"storage" oneoftype:"kind" env:"STORAGE" default:"{\"kind\": \"disk\"}"`
+	Backup  any              `oneoftype:"kind"`
+	Plugin  any
+}
+
+// Test interface fields with the type selected by oneoftype from defaults, environment variables and decoded objects
+func TestOneOfType(t *testing.T) {
+
+	_ = RegisterType("s3", &OneOfTestS3{})
+	_ = RegisterType("disk", OneOfTestDisk{})
+	if RegisterType("s3", &OneOfTestS3{}) == nil {
+		t.Errorf("Duplicate registration was not detected")
+	}
+	if RegisterType("", &OneOfTestS3{}) == nil {
+		t.Errorf("Empty kind was not detected")
+	}
+
+	env := map[string]string{}
+	lookup := func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	}
+
+	// Defaults select the type by the discriminator
+	c := OneOfTestConfig{}
+	err := CheckStruct(&c, WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.Storage != (OneOfTestDisk{Path: "/var/lib"}) {
+		t.Errorf("Unexpected storage from default: %#v", c.Storage)
+	}
+
+	// Environment variables take JSON objects, the selected type is processed with its own annotations
+	env["STORAGE"] = `{"kind": "s3", "bucket": "files"}`
+	c = OneOfTestConfig{}
+	err = CheckStruct(&c, WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if s3, ok := c.Storage.(*OneOfTestS3); !ok || *s3 != (OneOfTestS3{Bucket: "files", Region: "eu-north-1"}) {
+		t.Errorf("Unexpected storage from environment variable: %#v", c.Storage)
+	}
+
+	for name, value := range map[string]string{
+		"required":     `{"kind": "s3"}`,
+		"unknown kind": `{"kind": "gcs"}`,
+		"missing kind": `{"bucket": "files"}`,
+		"not object":   `["s3"]`,
+	} {
+		env["STORAGE"] = value
+		err = CheckStruct(&OneOfTestConfig{}, WithLookupEnv(lookup))
+		if err == nil {
+			t.Errorf("Invalid storage was not detected: %s", name)
+		}
+	}
+	delete(env, "STORAGE")
+
+	// Values held by interfaces are processed, decoded objects in fields of type any are converted
+	c = OneOfTestConfig{Storage: &OneOfTestS3{Bucket: "files"}, Backup: map[string]any{"kind": "disk"}, Plugin: &OneOfTestDisk{}}
+	err = CheckStruct(&c, WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.Storage.(*OneOfTestS3).Region != "eu-north-1" || c.Backup != (OneOfTestDisk{Path: "/var/lib"}) || c.Plugin.(*OneOfTestDisk).Path != "/var/lib" {
+		t.Errorf("Unexpected values: %#v", c)
+	}
+
+	// Config files select the type before they are decoded
+	file := filepath.Join(t.TempDir(), "config.json")
+	err = os.WriteFile(file, []byte(`{"storage": {"kind": "s3", "bucket": "files", "key": "hunter2"}}`), 0o600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	loaded, err := Load[OneOfTestConfig](WithFiles(file), WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if s3, ok := loaded.Storage.(*OneOfTestS3); !ok || s3.Bucket != "files" || s3.Key != "hunter2" {
+		t.Errorf("Unexpected storage from file: %#v", loaded.Storage)
+	}
+
+	// Secrets of structs held by interfaces are redacted
+	var b strings.Builder
+	err = Dump(&b, &loaded, FormatTable)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if strings.Contains(b.String(), "hunter2") || !strings.Contains(b.String(), "Storage.Bucket") {
+		t.Errorf("Unexpected dump:\n%s", b.String())
+	}
+
+	type invalid struct {
+		Name string `oneoftype:"kind"`
+	}
+	if CheckStruct(&invalid{}) == nil {
+		t.Errorf("oneoftype on a string field was not detected")
+	}
+}
+
+type cycleTestNode struct {
+	Name string `default:"node"`
+	Next any
+}
+
+// Test that pointers held by interfaces back to structs that are already processed do not recurse forever
+func TestInterfaceCycles(t *testing.T) {
+
+	a, b := &cycleTestNode{}, &cycleTestNode{Name: "b"}
+	a.Next, b.Next = b, a
+	err := CheckStruct(a)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if a.Name != "node" || b.Name != "b" {
+		t.Errorf("Unexpected values: %s, %s", a.Name, b.Name)
+	}
+
+	self := &cycleTestNode{}
+	self.Next = self
+	report := &Report{}
+	err = CheckStruct(self, WithReport(report))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(report.Fields) != 2 {
+		t.Errorf("Struct was processed more than once: %+v", report.Fields)
+	}
+}
+
+// Test skipping fields tagged defcon:"-", opaque types and unexported fields with WithSkipUnexported
+func TestSkipFields(t *testing.T) {
+
+	type internal struct {
+		Name string `required:"true"`
+	}
+	type config struct {
+		mu       sync.Mutex
+		Started  time.Time `required:"true"`
+		Hits     atomic.Int64
+		Cache    map[string]string `defcon:"-" env:"CACHE"`
+		Internal internal          `defcon:"-"`
+		level    string            `default:"info"`
+		Name     string            `default:"a"`
+	}
+
+	report := &Report{}
+	c := config{Started: time.Now()}
+	err := CheckStruct(&c, WithReport(report))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.level != "info" || c.Name != "a" {
+		t.Errorf("Unexpected values: level %s, name %s", c.level, c.Name)
+	}
+
+	// Opaque types are handled as a whole
+	if _, found := report.Get("Started"); !found {
+		t.Errorf("Opaque type was not reported as a leaf: %+v", report.Fields)
+	}
+	if _, found := report.Get("Started.wall"); found {
+		t.Errorf("Opaque type was descended into")
+	}
+	err = CheckStruct(&config{})
+	if err == nil || !strings.Contains(err.Error(), "required") {
+		t.Errorf("Required opaque type was not detected: %v", err)
+	}
+
+	// Skipped fields are not processed, dumped or reported
+	if _, found := report.Get("Cache"); found {
+		t.Errorf("Skipped field was reported")
+	}
+	var b strings.Builder
+	err = Dump(&b, &c, FormatTable)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if strings.Contains(b.String(), "Cache") || strings.Contains(b.String(), "Internal") {
+		t.Errorf("Skipped fields were dumped:\n%s", b.String())
+	}
+
+	// Unexported fields can be left untouched
+	c = config{Started: time.Now()}
+	err = CheckStruct(&c, WithSkipUnexported())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.level != "" || c.Name != "a" {
+		t.Errorf("Unexpected values: level %s, name %s", c.level, c.Name)
+	}
+
+	type hidden struct {
+		state struct {
+			Count int `required:"true"`
+		}
+	}
+	if CheckStruct(&hidden{}) == nil {
+		t.Errorf("Unexported struct was not processed")
+	}
+	if err := CheckStruct(&hidden{}, WithSkipUnexported()); err != nil {
+		t.Errorf("Unexported struct was processed: %s", err)
+	}
+
+	// Exported fields promoted from embedded structs of unexported types are processed
+	type common struct {
+		Level string `default:"info"`
+		state string `default:"idle"`
+	}
+	type embedding struct {
+		common
+	}
+	e := embedding{}
+	err = CheckStruct(&e, WithSkipUnexported())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if e.Level != "info" || e.state != "" {
+		t.Errorf("Unexpected values of embedded struct: level %s, state %s", e.Level, e.state)
+	}
+}
+
+// Test requires with paths from the root struct and relative to enclosing structs, and the paths named in errors
+func TestRequiresPaths(t *testing.T) {
+
+	type backend struct {
+		Name string `requires:"..TLS.CertFile"`
+	}
+	type config struct {
+		Hostname string `env:"HOSTNAME"`
+		Database struct {
+			Host     string
+			User     string `requires:"Hostname, Database.Host"`
+			Password string `requires:"User"`
+		}
+		TLS struct {
+			CertFile string `requires:"..Database.Host"`
+			KeyFile  string `requires:".CertFile"`
+		}
+		Backends []backend
+	}
+
+	env := map[string]string{}
+	lookup := func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	}
+
+	c := config{Hostname: "example.com", Backends: []backend{{Name: "a"}}}
+	c.Database.Host, c.Database.User = "db", "admin"
+	c.TLS.CertFile, c.TLS.KeyFile = "cert.pem", "key.pem"
+	err := CheckStruct(&c, WithLookupEnv(lookup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Errors name the full paths of both fields
+	for expected, c := range map[string]config{
+		"field Database.User requires field Hostname to be set":        {Database: c.Database},
+		"field TLS.CertFile requires field Database.Host to be set":    {TLS: c.TLS},
+		"field Backends[1].Name requires field TLS.CertFile to be set": {Backends: []backend{{}, {Name: "b"}}},
+	} {
+		err = CheckStruct(&c, WithLookupEnv(lookup))
+		if err == nil || !strings.HasSuffix(err.Error(), expected) {
+			t.Errorf("Unexpected error. Wanted '%s', got '%v'", expected, err)
+		}
+	}
+
+	// Fields of the same struct are named by their full paths as well
+	missingUser := config{}
+	missingUser.Database.Password = "secret"
+	err = CheckStruct(&missingUser, WithLookupEnv(lookup))
+	if err == nil || err.Error() != "field Database.Password requires field Database.User to be set" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Fields provided by environment variables are set, even with zero values
+	env["HOSTNAME"] = ""
+	err = CheckStruct(&config{Database: c.Database}, WithLookupEnv(lookup))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	// Invalid paths
+	type aboveRoot struct {
+		Name string `requires:"..Name"`
+	}
+	type missing struct {
+		Name string `requires:"Database.Host"`
+	}
+	for name, c := range map[string]any{"goes above the root struct": &aboveRoot{Name: "a"}, "does not exist": &missing{Name: "a"}} {
+		err = CheckStruct(c)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Invalid path was not detected: %v", err)
+		}
+	}
+}
+
+// Test that requires sees the defaults of referenced fields regardless of the order in which they are declared
+func TestRequiresDeclarationOrder(t *testing.T) {
+
+	type tls struct {
+		CertFile string `requires:"Hostname"`
+	}
+	type hostnameBefore struct {
+		Hostname string `default:"localhost"`
+		TLS      tls
+	}
+	type hostnameAfter struct {
+		TLS      tls
+		Hostname string `default:"localhost"`
+	}
+	type localBefore struct {
+		Hostname string `default:"localhost"`
+		CertFile string `default:"cert.pem" requires:"Hostname"`
+	}
+	type localAfter struct {
+		CertFile string `default:"cert.pem" requires:"Hostname"`
+		Hostname string `default:"localhost"`
+	}
+	type unset struct {
+		CertFile string `default:"cert.pem" requires:"Hostname"`
+		Hostname string
+	}
+
+	for _, c := range []any{&hostnameBefore{TLS: tls{CertFile: "cert.pem"}}, &hostnameAfter{TLS: tls{CertFile: "cert.pem"}}, &localBefore{}, &localAfter{}} {
+		err := CheckStruct(c)
+		if err != nil {
+			t.Errorf("Unexpected error for %T: %s", c, err)
+		}
+	}
+
+	// The annotated field is checked with its default applied as well
+	err := CheckStruct(&unset{})
+	if err == nil || err.Error() != "field CertFile requires field Hostname to be set" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
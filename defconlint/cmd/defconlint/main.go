@@ -0,0 +1,16 @@
+// Command defconlint reports mistakes in defcon struct tags.
+//
+// Run it on packages directly, or as a vet tool;
+//
+//	defconlint ./...
+//	go vet -vettool=$(which defconlint) ./...
+package main
+
+import (
+	"github.com/kjansson/defcon/defconlint"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(defconlint.Analyzer)
+}
@@ -0,0 +1,513 @@
+// Package defconlint defines an analyzer that reports mistakes in defcon struct tags at compile time.
+//
+// The analyzer reports non-boolean values of boolean annotations, invalid regular expressions, ranges and default values,
+// annotations on fields of types they do not apply to and references to fields that do not exist.
+// Run it with the defconlint command, or as a vet tool with "go vet -vettool=$(which defconlint) ./...".
+//
+// Only packages importing github.com/kjansson/defcon are analyzed, as tags such as "required" or "default" are used by other libraries too.
+// Config structs declared in packages that do not import defcon are checked with the -all flag, at the risk of reporting tags meant for other libraries.
+package defconlint
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kjansson/defcon"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// Analyzer reports mistakes in defcon struct tags
+var Analyzer = &analysis.Analyzer{
+	Name:     "defconlint",
+	Doc:      "check defcon struct tags\n\nReports mistakes in defcon annotations that CheckStruct would otherwise only report at runtime, such as invalid regular expressions, non-boolean values of boolean annotations, annotations on fields of unsupported types and references to missing fields.",
+	URL:      "https://github.com/kjansson/defcon",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// defconPath is the import path of the defcon package
+const defconPath = "github.com/kjansson/defcon"
+
+// checkAll is set by the -all flag to analyze packages that do not import defcon
+var checkAll bool
+
+func init() {
+	Analyzer.Flags.BoolVar(&checkAll, "all", false, "check struct tags in packages that do not import "+defconPath)
+}
+
+// Annotations grouped by the kind of value they take
+var (
+	boolKeys      = []string{"required", "unique", "secret"}
+	regexpKeys    = []string{"mustmatch", "mustnotmatch"}
+	listKeys      = []string{"musthave", "alwayshas"}
+	fieldListKeys = []string{"requires", "excludes", "exactlyone", "atleastone", "atmostone"}
+	fieldPathKeys = []string{"defaultfrom", "ltfield", "ltefield", "gtfield", "gtefield", "eqfield", "nefield"}
+	otherKeys     = []string{"default", "env", "sep", "oneoftype", "validrange", "validate", "assert", "desc", "reload", "errormsg"}
+)
+
+func run(pass *analysis.Pass) (any, error) {
+
+	// Tags of packages that do not use defcon are likely meant for other libraries
+	if !checkAll && !importsDefcon(pass.Pkg) {
+		return nil, nil
+	}
+
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	insp.Preorder([]ast.Node{(*ast.StructType)(nil)}, func(n ast.Node) {
+		node := n.(*ast.StructType)
+		st, ok := pass.TypesInfo.TypeOf(node).(*types.Struct)
+		if !ok {
+			return
+		}
+		for _, field := range node.Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+			raw, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			t := pass.TypesInfo.TypeOf(field.Type)
+			if t == nil {
+				continue
+			}
+			c := &fieldCheck{pass: pass, lit: field.Tag, tag: reflect.StructTag(raw), st: st, typ: unwrapOptional(t), optional: unwrapOptional(t) != t}
+			c.check()
+		}
+	})
+
+	return nil, nil
+}
+
+// importsDefcon returns true if the package imports the defcon package directly
+func importsDefcon(pkg *types.Package) bool {
+	for _, imported := range pkg.Imports() {
+		if imported.Path() == defconPath {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldCheck checks the annotations of a single struct field
+type fieldCheck struct {
+	pass *analysis.Pass
+	lit  *ast.BasicLit     // Tag literal of the field, used for positions
+	tag  reflect.StructTag // Parsed tag of the field
+	st   *types.Struct     // Struct declaring the field, for resolving field references
+	typ  types.Type        // Type of the field, with Optional unwrapped
+
+	optional bool // True if the field is a defcon.Optional
+}
+
+func (c *fieldCheck) check() {
+
+	// Fields tagged defcon:"-" are skipped by defcon together with their annotations
+	if value, found := c.tag.Lookup("defcon"); found && strings.TrimSpace(value) == "-" {
+		for _, keys := range [][]string{boolKeys, regexpKeys, listKeys, fieldListKeys, fieldPathKeys, otherKeys} {
+			for _, key := range keys {
+				if _, found := c.tag.Lookup(key); found {
+					c.reportf(key, "%s annotation is ignored on fields tagged defcon:\"-\"", key)
+				}
+			}
+		}
+		return
+	}
+
+	for _, key := range boolKeys {
+		if value, found := c.tag.Lookup(key); found {
+			if _, err := strconv.ParseBool(value); err != nil {
+				c.reportf(key, "%s annotation must be a boolean, got %q", key, value)
+			}
+		}
+	}
+
+	elem, isList := listElem(c.typ)
+	if !isList {
+		elem = c.typ
+	}
+
+	for _, key := range regexpKeys {
+		if value, found := c.tag.Lookup(key); found {
+			if _, err := regexp.Compile(value); err != nil {
+				c.reportf(key, "invalid regular expression in %s annotation: %s", key, err)
+			}
+			if kind(elem) != "string" {
+				c.reportf(key, "%s annotation is only supported on strings and slices of strings, not %s", key, c.typ)
+			}
+		}
+	}
+
+	if value, found := c.tag.Lookup("validrange"); found {
+		if kind(elem) != "int" {
+			// Unsigned integers are rejected by CheckStruct
+			c.reportf("validrange", "validrange annotation is only supported on signed integers and slices of signed integers, not %s", c.typ)
+		} else if err := checkRange(value); err != nil {
+			c.reportf("validrange", "invalid range in validrange annotation: %s", err)
+		}
+	}
+
+	sep, found := c.tag.Lookup("sep")
+	if found && !isList {
+		c.reportf("sep", "sep annotation is only supported on slices, not %s", c.typ)
+	} else if found && sep == "" {
+		c.reportf("sep", "sep annotation must not be empty")
+	}
+
+	for _, key := range append([]string{"unique"}, listKeys...) {
+		if value, found := c.tag.Lookup(key); found {
+			if !isList {
+				c.reportf(key, "%s annotation is only supported on slices, not %s", key, c.typ)
+				continue
+			}
+			if key == "unique" {
+				continue
+			}
+			if _, isArray := c.typ.Underlying().(*types.Array); isArray && key == "alwayshas" {
+				c.reportf(key, "alwayshas annotation is not supported on arrays, values can not be appended to %s", c.typ)
+				continue
+			}
+			items, err := defcon.ParseList(value, sep)
+			if err != nil {
+				c.reportf(key, "invalid %s annotation: %s", key, err)
+			}
+			for _, item := range items {
+				if err := parseValue(item, elem); err != nil {
+					c.reportf(key, "invalid value %q in %s annotation: %s", item, key, err)
+				}
+			}
+		}
+	}
+
+	_, isInterface := c.typ.Underlying().(*types.Interface)
+	oneOfType, hasOneOfType := c.tag.Lookup("oneoftype")
+	if hasOneOfType && !isInterface {
+		c.reportf("oneoftype", "oneoftype annotation is only supported on interfaces, not %s", c.typ)
+	} else if hasOneOfType && strings.TrimSpace(oneOfType) == "" {
+		c.reportf("oneoftype", "oneoftype annotation must not be empty")
+	}
+	selectable := isInterface && hasOneOfType
+
+	if value, found := c.tag.Lookup("default"); found && value != "" {
+		if selectable {
+			if err := parseObject(value, strings.TrimSpace(oneOfType)); err != nil {
+				c.reportf("default", "invalid default value %q: %s", value, err)
+			}
+		} else if err := parseDefault(value, sep, c.typ); err != nil {
+			c.reportf("default", "invalid default value %q: %s", value, err)
+		}
+	}
+
+	if value, found := c.tag.Lookup("reload"); found {
+		if value := strings.TrimSpace(value); value != "live" && value != "restart" {
+			c.reportf("reload", "reload annotation must be live or restart, got %q", value)
+		}
+	}
+
+	if value, found := c.tag.Lookup("defcon"); found {
+		switch strings.TrimSpace(value) {
+		case "inline", "squash":
+			if !isStruct(c.typ) || c.optional || isOpaque(c.typ) {
+				c.reportf("defcon", "defcon:%q is only supported on struct fields, not %s", value, c.typ)
+			}
+		default:
+			c.reportf("defcon", "defcon annotation must be inline, squash or -, got %q", value)
+		}
+	}
+
+	if _, found := c.tag.Lookup("env"); found && kind(elem) == "" && !(isList && isStruct(elem)) && !selectable {
+		c.reportf("env", "env annotation is not supported on fields of type %s", c.typ)
+	}
+
+	for _, key := range fieldListKeys {
+		if value, found := c.tag.Lookup(key); found {
+			for _, name := range splitList(value) {
+				if key == "requires" {
+					c.checkRequires(name)
+					continue
+				}
+				if _, found := lookupField(c.st, name); !found {
+					c.reportf(key, "%s annotation references unknown field %s", key, name)
+				}
+			}
+		}
+	}
+
+	for _, key := range fieldPathKeys {
+		if value, found := c.tag.Lookup(key); found {
+			path := strings.TrimSpace(value)
+			if !c.resolve(path) {
+				c.reportf(key, "%s annotation references unknown field %s", key, path)
+			}
+		}
+	}
+}
+
+// reportf reports a diagnostic at the position of the annotation within the tag
+func (c *fieldCheck) reportf(key, format string, args ...any) {
+	c.pass.Reportf(c.pos(key), format, args...)
+}
+
+// pos returns the position of an annotation within the tag literal, or the position of the literal if it is not a raw string
+func (c *fieldCheck) pos(key string) token.Pos {
+	raw := c.lit.Value
+	if !strings.HasPrefix(raw, "`") {
+		return c.lit.Pos()
+	}
+	for i := 0; i < len(raw); {
+		j := strings.Index(raw[i:], key+`:"`)
+		if j < 0 {
+			break
+		}
+		if prev := raw[i+j-1]; prev == '`' || prev == ' ' || prev == '\t' {
+			return c.lit.Pos() + token.Pos(i+j)
+		}
+		i += j + 1
+	}
+	return c.lit.Pos()
+}
+
+// resolve returns true if a field name or dotted path to a nested field exists in the struct
+func (c *fieldCheck) resolve(path string) bool {
+	var t types.Type = c.st
+	for _, name := range strings.Split(path, ".") {
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return false
+		}
+		field, found := lookupField(st, name)
+		if !found {
+			return false
+		}
+		t = unwrapOptional(field.Type())
+	}
+	return true
+}
+
+// checkRequires checks a field name or path of a "requires" annotation. Names not declared by the struct and paths without leading dots are resolved
+// from the root struct and paths with more than one leading dot from an enclosing struct, which are not known here, so only their syntax is checked.
+func (c *fieldCheck) checkRequires(name string) {
+	rest := strings.TrimLeft(name, ".")
+	for _, part := range strings.Split(rest, ".") {
+		if !token.IsIdentifier(part) {
+			c.reportf("requires", "invalid field path %s in requires annotation", name)
+			return
+		}
+	}
+	if len(name)-len(rest) == 1 && !c.resolve(rest) {
+		c.reportf("requires", "requires annotation references unknown field %s", name)
+	}
+}
+
+// lookupField returns the named field of the struct, including fields promoted from embedded structs and fields tagged `defcon:"inline"` or `defcon:"squash"`, as CheckStruct does.
+// Optional and opaque types and fields tagged `defcon:"-"` are not descended into.
+// As for embedded fields in Go, shallower fields take precedence and names that are ambiguous at the same depth are not found.
+func lookupField(st *types.Struct, name string) (*types.Var, bool) {
+	level := []*types.Struct{st}
+	for len(level) > 0 {
+		found := []*types.Var{}
+		next := []*types.Struct{}
+		for _, st := range level {
+			for i := 0; i < st.NumFields(); i++ {
+				f := st.Field(i)
+				if f.Name() == name {
+					found = append(found, f)
+				}
+				option := strings.TrimSpace(reflect.StructTag(st.Tag(i)).Get("defcon"))
+				if inner, ok := f.Type().Underlying().(*types.Struct); ok && isStruct(f.Type()) && !isOpaque(f.Type()) && option != "-" && (f.Embedded() || option == "inline" || option == "squash") {
+					next = append(next, inner)
+				}
+			}
+		}
+		switch len(found) {
+		case 0:
+			level = next
+		case 1:
+			return found[0], true
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// unwrapOptional returns the wrapped type of a defcon.Optional, other types are returned as is
+func unwrapOptional(t types.Type) types.Type {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != defconPath || named.Obj().Name() != "Optional" || named.TypeArgs().Len() != 1 {
+		return t
+	}
+	return named.TypeArgs().At(0)
+}
+
+// listElem returns the element type of slices and arrays
+func listElem(t types.Type) (types.Type, bool) {
+	switch u := t.Underlying().(type) {
+	case *types.Slice:
+		return u.Elem(), true
+	case *types.Array:
+		return u.Elem(), true
+	default:
+		return nil, false
+	}
+}
+
+// isStruct returns true for struct types other than defcon.Optional
+func isStruct(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Struct)
+	return ok && unwrapOptional(t) == t
+}
+
+// isOpaque returns true for struct types that are never descended into, as their fields are internal state, e.g. time.Time, sync.Mutex and atomic.Int64
+func isOpaque(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	path := named.Obj().Pkg().Path()
+	return (path == "time" && named.Obj().Name() == "Time") || path == "sync" || path == "sync/atomic"
+}
+
+// kind returns the type family of a primitive type, or an empty string for other types
+func kind(t types.Type) string {
+	b, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return ""
+	}
+	switch {
+	case b.Info()&types.IsString != 0:
+		return "string"
+	case b.Info()&types.IsBoolean != 0:
+		return "bool"
+	case b.Info()&types.IsInteger != 0 && b.Info()&types.IsUnsigned != 0:
+		return "uint"
+	case b.Info()&types.IsInteger != 0:
+		return "int"
+	case b.Info()&types.IsFloat != 0:
+		return "float"
+	default:
+		return ""
+	}
+}
+
+// bitSize returns the size in bits of a numeric type, 0 for int and uint
+func bitSize(t types.Type) int {
+	b := t.Underlying().(*types.Basic)
+	switch b.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32, types.Float32:
+		return 32
+	case types.Int64, types.Uint64, types.Float64:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// parseValue checks that a value can be parsed into a primitive type
+func parseValue(value string, t types.Type) error {
+	var err error
+	switch kind(t) {
+	case "string":
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "int":
+		_, err = strconv.ParseInt(value, 10, bitSize(t))
+	case "uint":
+		_, err = strconv.ParseUint(value, 10, bitSize(t))
+	case "float":
+		_, err = strconv.ParseFloat(value, bitSize(t))
+	default:
+		return fmt.Errorf("type %s is not supported", t)
+	}
+	if numErr, ok := err.(*strconv.NumError); ok {
+		return numErr.Err
+	}
+	return err
+}
+
+// parseDefault checks that a default value can be parsed into the type of a field, slices take a list as accepted by defcon.ParseList and slices of structs a JSON array of objects
+func parseDefault(value, sep string, t types.Type) error {
+	elem, isList := listElem(t)
+	if !isList {
+		return parseValue(value, t)
+	}
+	if isStruct(elem) {
+		var objects []map[string]any
+		if err := json.Unmarshal([]byte(value), &objects); err != nil {
+			return fmt.Errorf("slices of structs take a JSON array of objects: %s", err)
+		}
+		return nil
+	}
+	items, err := defcon.ParseList(value, sep)
+	if err != nil {
+		return err
+	}
+	// Fewer elements are allowed with defcon.WithArrayPadding, which is not known at compile time
+	if array, ok := t.Underlying().(*types.Array); ok && int64(len(items)) > array.Len() {
+		return fmt.Errorf("array of length %d takes at most %d elements, got %d", array.Len(), array.Len(), len(items))
+	}
+	for _, item := range items {
+		if err := parseValue(item, elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseObject checks that a default value of an interface field is a JSON object with a discriminator selecting its type
+func parseObject(value, key string) error {
+	var object map[string]any
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return fmt.Errorf("interfaces take a JSON object: %s", err)
+	}
+	if _, ok := object[key].(string); !ok {
+		return fmt.Errorf("object has no %s of type string selecting its type", key)
+	}
+	return nil
+}
+
+// checkRange checks the syntax of a validrange annotation, e.g. "1-10, 44, 100-200"
+func checkRange(value string) error {
+	parts := splitList(value)
+	if len(parts) == 0 {
+		return fmt.Errorf("range is empty")
+	}
+	for _, part := range parts {
+		// Search for the range separator after the first character to allow negative lower bounds
+		bounds := []string{part}
+		if idx := strings.Index(part[1:], "-"); idx >= 0 {
+			bounds = []string{part[:idx+1], part[idx+2:]}
+		}
+		for _, bound := range bounds {
+			if _, err := strconv.ParseInt(strings.TrimSpace(bound), 10, 64); err != nil {
+				return fmt.Errorf("%s is not an integer or a range of integers", part)
+			}
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated annotation value and trims whitespace from each element
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,40 @@
+package defconlint_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kjansson/defcon/defconlint"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// Test reporting mistakes in defcon tags
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), defconlint.Analyzer, "a")
+}
+
+// errorRecorder collects the errors of analysistest.Run instead of failing the test
+type errorRecorder struct {
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// Test that packages not importing defcon are only analyzed with the -all flag
+func TestAnalyzerScope(t *testing.T) {
+
+	// The expected diagnostic of package b is missing without the flag
+	results := analysistest.Run(&errorRecorder{}, analysistest.TestData(), defconlint.Analyzer, "b")
+	if len(results) != 1 || len(results[0].Diagnostics) != 0 {
+		t.Errorf("Package not importing defcon was analyzed: %v", results)
+	}
+
+	err := defconlint.Analyzer.Flags.Set("all", "true")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer defconlint.Analyzer.Flags.Set("all", "false")
+	analysistest.Run(t, analysistest.TestData(), defconlint.Analyzer, "b")
+}
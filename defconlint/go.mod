@@ -0,0 +1,17 @@
+module github.com/kjansson/defcon/defconlint
+
+go 1.25.4
+
+require (
+	github.com/kjansson/defcon v0.0.0-20261018222757-540da1409f29
+	golang.org/x/tools v0.37.0
+)
+
+require (
+	github.com/kjansson/go-intervals v1.0.0 // indirect
+	golang.org/x/mod v0.28.0 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+)
+
+// The analyzer is developed together with the library
+replace github.com/kjansson/defcon => ../
@@ -0,0 +1,78 @@
+package a
+
+import (
+	"time"
+
+	"github.com/kjansson/defcon"
+)
+
+// Packages are only analyzed if they import defcon
+var _ = defcon.CheckStruct
+
+type Database struct {
+	Host string
+	Port int
+}
+
+type Config struct {
+	Name     string            `required:"yes"`                        // want `required annotation must be a boolean, got "yes"`
+	Pattern  string            `mustmatch:"^[a-z+$"`                   // want `invalid regular expression in mustmatch annotation`
+	Port     string            `validrange:"1-65535"`                  // want `validrange annotation is only supported on signed integers and slices of signed integers, not string`
+	Weight   uint16            `validrange:"1-10"`                     // want `validrange annotation is only supported on signed integers and slices of signed integers, not uint16`
+	Level    int               `validrange:"1-a"`                      // want `invalid range in validrange annotation: 1-a is not an integer`
+	User     string            `requires:".Password"`                  // want `requires annotation references unknown field .Password`
+	Timeout  time.Duration     `default:"5s"`                          // want `invalid default value "5s": invalid syntax`
+	Tags     []string          `default:"a, \"b"`                      // want `invalid default value "a, \\"b": list value 'a, "b' has an invalid quoted element`
+	Ports    []int             `musthave:"80, http" unique:"true"`     // want `invalid value "http" in musthave annotation`
+	Count    int               `unique:"true"`                         // want `unique annotation is only supported on slices, not int`
+	Min      int               `ltfield:"Database.Port" gtfield:"Max"` // want `gtfield annotation references unknown field Max`
+	Size     uint8             `default:"300"`                         // want `invalid default value "300": value out of range`
+	Enabled  bool              `mustnotmatch:"x"`                      // want `mustnotmatch annotation is only supported on strings and slices of strings, not bool`
+	Backends []Database        `env:"BACKENDS" default:"[{\"Host\": \"a\"}]"`
+	Replicas []Database        `default:"{a, b}"` // want `invalid default value "{a, b}": slices of structs take a JSON array of objects`
+	Labels   map[string]string `env:"LABELS"`     // want `env annotation is not supported on fields of type map\[string\]string`
+	Database Database          `reload:"later"`   // want `reload annotation must be live or restart, got "later"`
+	Valid    []int             `default:"{1, 2}" validrange:"1-10, 20" alwayshas:"3"`
+	Plain    []int             `default:"[1, 2]" musthave:"1;2" sep:";"`
+	Retries  int               `sep:";"`                                                               // want `sep annotation is only supported on slices, not int`
+	Key      [2]byte           `default:"1, 2, 3"`                                                     // want `invalid default value "1, 2, 3": array of length 2 takes at most 2 elements, got 3`
+	Pair     [2]string         `default:"a" alwayshas:"b"`                                             // want `alwayshas annotation is not supported on arrays`
+	Mode     string            `default:"fast" mustmatch:"^[a-z]+$" requires:"Name, .Host" env:"MODE"` // want `requires annotation references unknown field .Host`
+	_        struct{}          `exactlyone:"Name, Pattern"`
+}
+
+type Logging struct {
+	Level string
+	File  string
+}
+
+type Server struct {
+	Logging
+	TLS   Database `defcon:"inline"`
+	Audit bool     `requires:"File, Host, Region, ..Name, Database..Host"` // want `invalid field path Database..Host in requires annotation`
+	Limit int      `ltfield:"Port" gtfield:"TLS.Port"`
+	Name  string   `defcon:"inline"` // want `defcon:"inline" is only supported on struct fields, not string`
+	Mode  Database `defcon:"flat"`   // want `defcon annotation must be inline, squash or -, got "flat"`
+}
+
+type Clock struct {
+	time.Time
+	Zone    string    `eqfield:"loc"`   // want `eqfield annotation references unknown field loc`
+	Started time.Time `defcon:"inline"` // want `defcon:"inline" is only supported on struct fields, not time.Time`
+}
+
+type Storage interface {
+	Location() string
+}
+
+type Plugins struct {
+	Storage Storage `oneoftype:"kind" env:"STORAGE" default:"{\"kind\": \"disk\"}"`
+	Backup  Storage `oneoftype:"kind" default:"{\"type\": \"disk\"}"` // want `invalid default value "{\\"type\\": \\"disk\\"}": object has no kind of type string selecting its type`
+	Cache   Storage `env:"CACHE"`                                     // want `env annotation is not supported on fields of type a.Storage`
+	Kind    string  `oneoftype:"kind"`                                // want `oneoftype annotation is only supported on interfaces, not string`
+}
+
+type Cache struct {
+	Entries map[string]string `defcon:"-"`
+	Size    int               `defcon:"-" default:"a"` // want `default annotation is ignored on fields tagged defcon:"-"`
+}
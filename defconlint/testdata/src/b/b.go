@@ -0,0 +1,6 @@
+// Package b does not import defcon, its tags are only checked with the -all flag
+package b
+
+type Config struct {
+	Name string `required:"yes"` // want `required annotation must be a boolean, got "yes"`
+}
@@ -0,0 +1,263 @@
+package defcon
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Values of the "reload" annotation
+const (
+	ReloadLive    = "live"    // Changes of the field can be applied while running
+	ReloadRestart = "restart" // Changes of the field require a restart
+)
+
+// Change is a field whose value differs between two configs
+type Change struct {
+	Path    string // Path of the field from the root struct, e.g. "Backends[0].Host" or "Labels[env]"
+	Old     any    // Old value, nil if the field was added. Redacted for fields annotated with `secret:"true"` and values holding such fields
+	New     any    // New value, nil if the field was removed. Redacted for fields annotated with `secret:"true"` and values holding such fields
+	Restart bool   // True if the change requires a restart according to the "reload" annotation
+}
+
+func (c Change) String() string {
+	reload := ReloadLive
+	if c.Restart {
+		reload = ReloadRestart
+	}
+	return fmt.Sprintf("%s: %s -> %s (%s)", c.Path, formatValue(c.Old), formatValue(c.New), reload)
+}
+
+// RequiresRestart returns true if any of the changes requires a restart
+func RequiresRestart(changes []Change) bool {
+	for _, change := range changes {
+		if change.Restart {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the fields that differ between two configs of the same struct type, walking nested structs, slices of structs and maps.
+// Changes are classified by the "reload" annotation of the field or its closest annotated parent, fields without one are assumed to require a restart.
+// A nil config is treated as the zero value of the other config's type.
+func Diff(old, new any) []Change {
+
+	o, n := diffRoot(old), diffRoot(new)
+	switch {
+	case !o.IsValid() && !n.IsValid():
+		return nil
+	case !o.IsValid():
+		o = reflect.New(n.Type()).Elem()
+	case !n.IsValid():
+		n = reflect.New(o.Type()).Elem()
+	}
+	if o.Type() != n.Type() {
+		return []Change{{Path: "", Old: fmt.Sprintf("<%s>", o.Type()), New: fmt.Sprintf("<%s>", n.Type()), Restart: true}}
+	}
+
+	changes := []Change{}
+	diffValues(&changes, "", o, n, true, false, map[[2]visit]bool{})
+	return changes
+}
+
+// diffRoot dereferences a config and returns an addressable copy, to allow access to unexported fields
+func diffRoot(config any) reflect.Value {
+	v := reflect.ValueOf(config)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.CanAddr() {
+		return v
+	}
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+// diffValues compares two values of the same type and records the changes.
+// Pairs of pointers are followed once, so that configs with pointer cycles are compared to the first repetition.
+func diffValues(changes *[]Change, path string, o, n reflect.Value, restart, secret bool, visited map[[2]visit]bool) {
+
+	// Values are recorded as a whole, redacted if they hold secrets. Invalid values, e.g. of added or removed elements, are recorded as nil.
+	change := func(path string, o, n reflect.Value) {
+		*changes = append(*changes, Change{Path: path, Old: diffRedacted(o, secret), New: diffRedacted(n, secret), Restart: restart})
+	}
+
+	if isOptional(o.Type()) {
+		if !reflect.DeepEqual(reportValue(o), reportValue(n)) {
+			change(path, o, n)
+		}
+		return
+	}
+
+	// Types with an Equal method, e.g. time.Time, are compared as a whole
+	if equal := o.MethodByName("Equal"); equal.IsValid() && equal.Type().NumIn() == 1 && equal.Type().In(0) == o.Type() &&
+		equal.Type().NumOut() == 1 && equal.Type().Out(0).Kind() == reflect.Bool {
+		if !equal.Call([]reflect.Value{n})[0].Bool() {
+			change(path, o, n)
+		}
+		return
+	}
+
+	// Opaque types, e.g. sync.Mutex, are compared as a whole instead of by their internal state
+	if isOpaque(o.Type()) {
+		if !reflect.DeepEqual(diffValue(o), diffValue(n)) {
+			change(path, o, n)
+		}
+		return
+	}
+
+	switch o.Kind() {
+	case reflect.Struct:
+		for i := 0; i < o.NumField(); i++ {
+			sf := o.Type().Field(i)
+			if isSkipped(sf) {
+				continue
+			}
+			fieldRestart, fieldSecret := diffAnnotations(sf, restart, secret)
+			fieldPath := joinPath(path, sf.Name)
+			if isInline(sf) {
+				fieldPath = path
+			}
+			diffValues(changes, fieldPath, diffField(o, i), diffField(n, i), fieldRestart, fieldSecret, visited)
+		}
+
+	case reflect.Pointer:
+		switch {
+		case o.IsNil() && n.IsNil():
+		case o.IsNil() || n.IsNil():
+			change(path, o, n)
+		default:
+			key := [2]visit{{ptr: o.Pointer(), typ: o.Type()}, {ptr: n.Pointer(), typ: n.Type()}}
+			if visited[key] {
+				return
+			}
+			visited[key] = true
+			diffValues(changes, path, o.Elem(), n.Elem(), restart, secret, visited)
+		}
+
+	case reflect.Slice, reflect.Array:
+		// Slices of structs are compared per element, like in CheckStruct, other slices are compared as a whole
+		if isLeaf(o) {
+			if !reflect.DeepEqual(diffValue(o), diffValue(n)) {
+				change(path, o, n)
+			}
+			return
+		}
+		for i := 0; i < max(o.Len(), n.Len()); i++ {
+			elementPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= o.Len():
+				change(elementPath, reflect.Value{}, n.Index(i))
+			case i >= n.Len():
+				change(elementPath, o.Index(i), reflect.Value{})
+			default:
+				diffValues(changes, elementPath, o.Index(i), n.Index(i), restart, secret, visited)
+			}
+		}
+
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		for _, key := range append(o.MapKeys(), n.MapKeys()...) {
+			keys[fmt.Sprint(key.Interface())] = key
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			elementPath := fmt.Sprintf("%s[%s]", path, name)
+			oldValue, newValue := o.MapIndex(keys[name]), n.MapIndex(keys[name])
+			switch {
+			case !oldValue.IsValid() || !newValue.IsValid():
+				change(elementPath, oldValue, newValue)
+			default:
+				diffValues(changes, elementPath, diffCopy(oldValue), diffCopy(newValue), restart, secret, visited)
+			}
+		}
+
+	case reflect.Interface:
+		// Values of the same dynamic type are compared like fields of that type, other values are compared as a whole
+		switch {
+		case o.IsNil() && n.IsNil():
+		case !o.IsNil() && !n.IsNil() && o.Elem().Type() == n.Elem().Type():
+			diffValues(changes, path, diffCopy(o.Elem()), diffCopy(n.Elem()), restart, secret, visited)
+		default:
+			change(path, o, n)
+		}
+
+	default:
+		if !reflect.DeepEqual(diffValue(o), diffValue(n)) {
+			change(path, o, n)
+		}
+	}
+}
+
+// diffCopy returns an addressable copy of a value, e.g. a map element or a value held by an interface, to allow access to unexported fields of structs
+func diffCopy(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+// diffRedacted returns the value of a change, redacted if the field is secret or the value holds structs with secret fields.
+// Invalid values and nil pointers are returned as nil.
+func diffRedacted(v reflect.Value, secret bool) any {
+	if !v.IsValid() {
+		return nil
+	}
+	value := diffValue(v)
+	if value != nil && (secret || containsSecrets(v)) {
+		return Redacted
+	}
+	return value
+}
+
+// diffField returns a struct field, with access to unexported fields if the struct is addressable
+func diffField(val reflect.Value, i int) reflect.Value {
+	v := val.Field(i)
+	if !val.Type().Field(i).IsExported() && v.CanAddr() {
+		v = reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+	}
+	return v
+}
+
+// diffValue returns a value for a change, dereferencing pointers
+func diffValue(v reflect.Value) any {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return reportValue(v)
+}
+
+// diffAnnotations returns whether changes of a field require a restart and whether its value is secret, inheriting from the parent if not annotated.
+// Invalid annotations are treated as requiring a restart and secret.
+func diffAnnotations(sf reflect.StructField, restart, secret bool) (bool, bool) {
+	if reload, found := sf.Tag.Lookup("reload"); found {
+		restart = strings.TrimSpace(reload) != ReloadLive
+	}
+	if value, found := sf.Tag.Lookup("secret"); found {
+		isSecret, err := strconv.ParseBool(value)
+		secret = secret || isSecret || err != nil
+	}
+	return restart, secret
+}
+
+// joinPath returns the path of a field given the path of its parent
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,95 @@
+package defcon
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/kjansson/defcon/internal/spec"
+)
+
+const (
+	FormatMarkdown Format = "markdown" // Markdown table
+	FormatHTML     Format = "html"     // HTML table
+)
+
+// GenerateDocs generates documentation for a config struct, listing the path, type, environment variable, default value,
+// required flag, valid range, regular expressions and description ("desc" annotation) of every field.
+// Nested structs and elements of slices of structs are walked recursively. Supported formats are FormatMarkdown and FormatHTML.
+func GenerateDocs(cfg any, format Format) (string, error) {
+
+	fields, err := describe(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	switch format {
+	case FormatMarkdown:
+		err = spec.WriteMarkdown(&b, fields)
+	case FormatHTML:
+		err = spec.WriteHTML(&b, fields)
+	default:
+		return "", fmt.Errorf("unsupported documentation format %s", format)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// describe returns the leaf fields of a config struct type
+func describe(cfg any) ([]spec.Field, error) {
+
+	t := reflect.TypeOf(cfg)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can not describe %v, expected a struct", t)
+	}
+
+	fields := []spec.Field{}
+	describeType(t, "", nil, &fields)
+
+	return fields, nil
+}
+
+// describeType walks a struct type the same way structField.handle walks its values, collecting leaf fields.
+// Types already being walked further up are treated as leaves to stop recursive types such as `Children []Node`.
+func describeType(t reflect.Type, path string, ancestors []reflect.Type, fields *[]spec.Field) {
+
+	ancestors = append(ancestors, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if isSkipped(sf) {
+			continue
+		}
+		fieldPath := spec.Join(path, sf.Name)
+		if isInline(sf) {
+			fieldPath = path
+		}
+		ft := sf.Type
+
+		switch {
+		case isOptional(ft), isOpaque(ft), slices.Contains(ancestors, ft), slices.Contains(ancestors, elemType(ft)):
+			*fields = append(*fields, spec.Field{Path: fieldPath, Type: ft.String(), Tag: sf.Tag})
+		case ft.Kind() == reflect.Struct:
+			describeType(ft, fieldPath, ancestors, fields)
+		case isStructList(ft):
+			describeType(ft.Elem(), fieldPath+"[]", ancestors, fields)
+		default:
+			*fields = append(*fields, spec.Field{Path: fieldPath, Type: ft.String(), Tag: sf.Tag})
+		}
+	}
+}
+
+// elemType returns the element type of slices and arrays, nil for other types
+func elemType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		return t.Elem()
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package defcon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unsafe"
+)
+
+// Format selects the output format of Dump
+type Format string
+
+const (
+	FormatTable Format = "table" // Aligned plain text table
+	FormatJSON  Format = "json"  // JSON array of fields
+	FormatYAML  Format = "yaml"  // YAML sequence of fields
+)
+
+// Redacted replaces the value of fields annotated with `secret:"true"` in printed output
+const Redacted = "[REDACTED]"
+
+// dumpEntry is a single field of a dumped config
+type dumpEntry struct {
+	Path        string            `json:"path"`
+	Type        string            `json:"type"`
+	Value       any               `json:"value"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	tags        string            // Annotations formatted as struct tags for table output, in the order of annotationKeys
+}
+
+// Dump prints the fields of a config struct, typically after CheckStruct has resolved it, together with their annotations.
+// Nested structs, pointers to structs, slices of structs and maps of structs are walked recursively, values of fields annotated with `secret:"true"` are redacted.
+// Values which are printed as a whole are redacted if their type holds secret fields.
+func Dump(w io.Writer, cfg any, format Format) error {
+
+	v := reflect.ValueOf(cfg)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return fmt.Errorf("can not dump a nil pointer")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("can not dump %s, expected a struct", v.Type())
+	}
+
+	// Make sure the struct is addressable to allow access to unexported fields
+	if !v.CanAddr() {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+
+	entries := []dumpEntry{}
+	visited := visits{}
+	if ptr := reflect.ValueOf(cfg); ptr.Kind() == reflect.Pointer {
+		visited.add(ptr)
+	}
+	err := collectEntries(v, "", false, visited, &entries)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatTable:
+		return writeTable(w, entries)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case FormatYAML:
+		return writeYAML(w, entries)
+	default:
+		return fmt.Errorf("unsupported dump format %s", format)
+	}
+}
+
+// collectEntries walks a struct the same way structField.handle does, collecting leaf fields.
+// Structs reached through pointers are walked once, fields pointing to a struct that is already walked are left out.
+func collectEntries(val reflect.Value, path string, secret bool, visited visits, entries *[]dumpEntry) error {
+
+	f := structField{}
+	for i := 0; i < val.NumField(); i++ {
+
+		sf := val.Type().Field(i)
+		if isSkipped(sf) {
+			continue
+		}
+		v := val.Field(i)
+		if !sf.IsExported() {
+			v = reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem() // Get access to unexported field
+		}
+
+		annotations, err := f.getAnnotations(sf)
+		if err != nil {
+			return fmt.Errorf("invalid annotation syntax: %s", err)
+		}
+		fieldPath := sf.Name
+		switch {
+		case isInline(sf):
+			fieldPath = path
+		case path != "":
+			fieldPath = path + "." + sf.Name
+		}
+		fieldSecret := secret || annotations.Secret
+
+		// Structs held by interfaces are walked, so that their secrets are redacted
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			elem := v.Elem()
+			if elem.Kind() == reflect.Pointer && !elem.IsNil() {
+				if isNestedStruct(elem.Type().Elem()) && !visited.add(elem) {
+					continue
+				}
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct && !isOptional(elem.Type()) && !isOpaque(elem.Type()) {
+				// Struct values held by interfaces are not addressable, copy them so that their unexported fields can be accessed
+				if !elem.CanAddr() {
+					copied := reflect.New(elem.Type()).Elem()
+					copied.Set(elem)
+					elem = copied
+				}
+				v = elem
+			}
+		}
+
+		// Structs behind non-nil pointers are walked like nested structs
+		if v.Kind() == reflect.Pointer && !v.IsNil() && isNestedStruct(v.Type().Elem()) {
+			if !visited.add(v) {
+				continue
+			}
+			v = v.Elem()
+		}
+
+		switch {
+		case v.Kind() == reflect.Map && isNestedStruct(derefType(v.Type().Elem())):
+			// Maps of structs are walked per element, in the order of their keys
+			keys := v.MapKeys()
+			sort.Slice(keys, func(a, b int) bool { return fmt.Sprint(keys[a].Interface()) < fmt.Sprint(keys[b].Interface()) })
+			for _, key := range keys {
+				elementPath := fmt.Sprintf("%s[%v]", fieldPath, key.Interface())
+				// Map elements are not addressable, copy them so that their unexported fields can be accessed
+				elem := reflect.New(v.Type().Elem()).Elem()
+				elem.Set(v.MapIndex(key))
+				if elem.Kind() == reflect.Pointer {
+					if elem.IsNil() {
+						*entries = append(*entries, newDumpEntry(sf, elementPath, elem, fieldSecret))
+						continue
+					}
+					if !visited.add(elem) {
+						continue
+					}
+					elem = elem.Elem()
+				}
+				err = collectEntries(elem, elementPath, fieldSecret, visited, entries)
+				if err != nil {
+					return err
+				}
+			}
+		case isLeaf(v):
+			*entries = append(*entries, newDumpEntry(sf, fieldPath, v, fieldSecret))
+		case v.Kind() == reflect.Struct:
+			err = collectEntries(v, fieldPath, fieldSecret, visited, entries)
+			if err != nil {
+				return err
+			}
+		default:
+			// Slices of structs are walked per element
+			for j := 0; j < v.Len(); j++ {
+				err = collectEntries(v.Index(j), fmt.Sprintf("%s[%d]", fieldPath, j), fieldSecret, visited, entries)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// newDumpEntry returns the entry of a leaf field. Secret values are redacted, as are values that could hold secrets of nested fields
+// which are not walked, e.g. pointers to structs held by slices.
+func newDumpEntry(sf reflect.StructField, path string, v reflect.Value, secret bool) dumpEntry {
+	entry := dumpEntry{Path: path, Type: v.Type().String(), Value: reportValue(v), Annotations: map[string]string{}}
+	if secret || (!v.IsZero() && containsSecrets(v)) {
+		entry.Value = Redacted
+	}
+	tags := []string{}
+	for _, key := range annotationKeys {
+		value, found := sf.Tag.Lookup(key)
+		if found {
+			entry.Annotations[key] = value
+			tags = append(tags, fmt.Sprintf("%s:%q", key, value))
+		}
+	}
+	entry.tags = strings.Join(tags, " ")
+	return entry
+}
+
+// writeTable writes the entries as an aligned table
+func writeTable(w io.Writer, entries []dumpEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tTYPE\tVALUE\tANNOTATIONS")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\n", entry.Path, entry.Type, formatValue(entry.Value), entry.tags)
+	}
+	return tw.Flush()
+}
+
+// formatValue formats a value for table output
+func formatValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "<unset>"
+	case string:
+		if value == Redacted {
+			return value
+		}
+		return fmt.Sprintf("%q", value)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// writeYAML writes the entries as a YAML sequence, scalar values are written as JSON which is valid YAML
+func writeYAML(w io.Writer, entries []dumpEntry) error {
+	for _, entry := range entries {
+		value, err := json.Marshal(entry.Value)
+		if err != nil {
+			return fmt.Errorf("could not encode value of field %s: %s", entry.Path, err)
+		}
+		fmt.Fprintf(w, "- path: %s\n", yamlString(entry.Path))
+		fmt.Fprintf(w, "  type: %s\n", yamlString(entry.Type))
+		fmt.Fprintf(w, "  value: %s\n", value)
+		if len(entry.Annotations) > 0 {
+			fmt.Fprintln(w, "  annotations:")
+			for _, key := range annotationKeys {
+				if annotation, found := entry.Annotations[key]; found {
+					fmt.Fprintf(w, "    %s: %s\n", key, yamlString(annotation))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// yamlString quotes a string for YAML, using JSON string syntax which is a valid YAML double quoted scalar
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
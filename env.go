@@ -0,0 +1,53 @@
+package defcon
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kjansson/defcon/internal/spec"
+)
+
+const (
+	FormatDotEnv        Format = "dotenv"    // Commented .env.example file
+	FormatKubernetesEnv Format = "k8s-env"   // "env:" section of a Kubernetes container spec
+	FormatConfigMap     Format = "configmap" // Kubernetes ConfigMap
+)
+
+// GenerateEnv generates an example environment from the "env" annotations of a config struct.
+// FormatDotEnv writes a commented .env.example with defaults filled in and required variables flagged,
+// FormatKubernetesEnv writes the "env:" section of a container spec with secrets referencing a Secret and
+// FormatConfigMap writes a ConfigMap with all non-secret variables. Kubernetes resources are named after the struct type, e.g. "server-config".
+func GenerateEnv(cfg any, format Format) (string, error) {
+
+	fields, err := describe(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	t := reflect.TypeOf(cfg)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	name := spec.KebabCase(t.Name())
+	if name == "" {
+		name = "config"
+	}
+
+	var b strings.Builder
+	switch format {
+	case FormatDotEnv:
+		err = spec.WriteEnvExample(&b, fields)
+	case FormatKubernetesEnv:
+		err = spec.WriteKubernetesEnv(&b, fields, name)
+	case FormatConfigMap:
+		err = spec.WriteConfigMap(&b, fields, name)
+	default:
+		return "", fmt.Errorf("unsupported environment format %s", format)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,781 @@
+package defcon
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Expressions used in the "assert" annotation are compiled once per struct type and cached
+var exprCache sync.Map // map[exprKey]*compiledExpr
+
+type exprKey struct {
+	t    reflect.Type
+	expr string
+}
+
+type compiledExpr struct {
+	root exprNode
+	err  error
+}
+
+// checkAssert compiles (or fetches from cache) an assertion for the struct type and evaluates it against the struct value
+func checkAssert(val *reflect.Value, expr string) error {
+
+	key := exprKey{t: val.Type(), expr: expr}
+	cached, found := exprCache.Load(key)
+	if !found {
+		root, err := compileExpr(expr, val.Type())
+		cached, _ = exprCache.LoadOrStore(key, &compiledExpr{root: root, err: err})
+	}
+	compiled := cached.(*compiledExpr)
+	if compiled.err != nil {
+		return fmt.Errorf("invalid assertion '%s': %s", expr, compiled.err)
+	}
+
+	result, err := compiled.root.eval(*val)
+	if err != nil {
+		return fmt.Errorf("could not evaluate assertion '%s': %s", expr, err)
+	}
+	ok, isBool := result.(bool)
+	if !isBool {
+		return fmt.Errorf("assertion '%s' does not evaluate to a boolean", expr)
+	}
+	if !ok {
+		return fmt.Errorf("assertion '%s' failed", expr)
+	}
+
+	return nil
+}
+
+// compileExpr parses an expression and resolves all field references against the struct type
+func compileExpr(expr string, t reflect.Type) (exprNode, error) {
+
+	tokens, err := lexExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens, t: t}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.peek().text, p.peek().pos)
+	}
+
+	return root, nil
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOperator
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Operators ordered so that two character operators are matched first
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+func lexExpr(expr string) ([]exprToken, error) {
+
+	tokens := []exprToken{}
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == '_') {
+				// A dot followed by a non-digit is field access, not part of the number
+				if runes[i] == '.' && (i+1 >= len(runes) || !unicode.IsDigit(runes[i+1])) {
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: string(runes[start:i]), pos: start})
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			quoted := string(runes[start:i])
+			if r == '\'' {
+				// Convert single quoted strings to double quoted for unquoting
+				quoted = `"` + strings.ReplaceAll(strings.ReplaceAll(quoted[1:len(quoted)-1], `\'`, `'`), `"`, `\"`) + `"`
+			}
+			text, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %s", start, err)
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: text, pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: string(runes[start:i]), pos: start})
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, exprToken{kind: tokOperator, text: op, pos: i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+			}
+		}
+	}
+
+	return append(tokens, exprToken{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// Parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	t      reflect.Type // Struct type that field references are resolved against
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given operator or keyword
+func (p *exprParser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == tokOperator || tok.kind == tokIdent) && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected '%s' at position %d", text, p.peek().pos)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			if op == "in" {
+				return &inNode{left: left, right: right}, nil
+			}
+			return &compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokOperator || (op != "+" && op != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokOperator || (op != "*" && op != "/" && op != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithNode{op: "-", left: &literalNode{value: int64(0)}, right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		text := strings.ReplaceAll(tok.text, "_", "")
+		if strings.Contains(text, ".") {
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' at position %d", tok.text, tok.pos)
+			}
+			return &literalNode{value: f}, nil
+		}
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", tok.text, tok.pos)
+		}
+		return &literalNode{value: i}, nil
+
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "nil":
+			return &literalNode{value: nil}, nil
+		case "len":
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return &lenNode{arg: arg}, nil
+		}
+		// Field reference, possibly a dotted path into nested structs
+		path := []string{tok.text}
+		for p.accept(".") {
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at position %d", name.pos)
+			}
+			path = append(path, name.text)
+		}
+		return p.resolveField(path)
+
+	case tokOperator:
+		switch tok.text {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			list := &listNode{}
+			if p.accept("]") {
+				return list, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if p.accept("]") {
+					return list, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if tok.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+}
+
+// resolveField resolves a field path against the struct type at compile time
+func (p *exprParser) resolveField(path []string) (exprNode, error) {
+
+	t := p.t
+	index := []int{}
+	for _, name := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("field %s can not be resolved, %s is not a struct", strings.Join(path, "."), t)
+		}
+		sf, found := fieldByName(t, name)
+		if !found {
+			return nil, fmt.Errorf("field %s does not exist", strings.Join(path, "."))
+		}
+		index = append(index, sf.Index...)
+		t = sf.Type
+	}
+
+	return &fieldNode{path: strings.Join(path, "."), index: index}, nil
+}
+
+// Evaluation
+
+type exprNode interface {
+	eval(v reflect.Value) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n *literalNode) eval(reflect.Value) (any, error) {
+	return n.value, nil
+}
+
+type fieldNode struct {
+	path  string
+	index []int
+}
+
+func (n *fieldNode) eval(v reflect.Value) (any, error) {
+	for _, i := range n.index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil, nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return exprValue(v)
+}
+
+// exprValue converts a reflect value into the value types used by the evaluator; int64, float64, string, bool, []any and nil
+func exprValue(v reflect.Value) (any, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Slice, reflect.Array:
+		list := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := exprValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case reflect.Map:
+		// Maps are represented by their keys, allowing "in" and len()
+		list := make([]any, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			item, err := exprValue(key)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return exprValue(v.Elem())
+	case reflect.Struct:
+		// Optional values are represented by their wrapped value, or nil if not set
+		if isOptional(v.Type()) && v.CanAddr() {
+			inner, present := unwrapOptional(v)
+			if !present {
+				return nil, nil
+			}
+			return exprValue(inner)
+		}
+		return nil, fmt.Errorf("values of type %s can not be used in expressions", v.Type())
+	default:
+		return nil, fmt.Errorf("values of type %s can not be used in expressions", v.Type())
+	}
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(v reflect.Value) (any, error) {
+	list := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(v)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+type lenNode struct {
+	arg exprNode
+}
+
+func (n *lenNode) eval(v reflect.Value) (any, error) {
+	value, err := n.arg.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	switch value := value.(type) {
+	case string:
+		return int64(len(value)), nil
+	case []any:
+		return int64(len(value)), nil
+	case nil:
+		return int64(0), nil
+	default:
+		return nil, fmt.Errorf("len() is not supported for %T", value)
+	}
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) eval(v reflect.Value) (any, error) {
+	value, err := n.operand.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator ! is not supported for %T", value)
+	}
+	return !b, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(v reflect.Value) (any, error) {
+	left, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := left.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator %s is not supported for %T", n.op, left)
+	}
+	// Short circuit evaluation
+	if (n.op == "&&" && !l) || (n.op == "||" && l) {
+		return l, nil
+	}
+	right, err := n.right.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := right.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator %s is not supported for %T", n.op, right)
+	}
+	return r, nil
+}
+
+type arithNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *arithNode) eval(v reflect.Value) (any, error) {
+	left, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// String concatenation
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok && n.op == "+" {
+			return l + r, nil
+		}
+	}
+
+	l, lInt := left.(int64)
+	r, rInt := right.(int64)
+	if lInt && rInt {
+		switch n.op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if n.op == "/" {
+				return l / r, nil
+			}
+			return l % r, nil
+		}
+	}
+
+	lf, lOk := toExprFloat(left)
+	rf, rOk := toExprFloat(right)
+	if !lOk || !rOk {
+		return nil, fmt.Errorf("operator %s is not supported for %T and %T", n.op, left, right)
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	default:
+		return nil, fmt.Errorf("operator %s is not supported for floats", n.op)
+	}
+}
+
+// toExprFloat converts a numeric evaluator value to float64
+func toExprFloat(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	default:
+		return 0, false
+	}
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) eval(v reflect.Value) (any, error) {
+	left, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "==" || n.op == "!=" {
+		equal, err := exprEqual(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return equal == (n.op == "=="), nil
+	}
+
+	var c int
+	ls, lStr := left.(string)
+	rs, rStr := right.(string)
+	lf, lNum := toExprFloat(left)
+	rf, rNum := toExprFloat(right)
+	switch {
+	case lStr && rStr:
+		c = strings.Compare(ls, rs)
+	case lNum && rNum:
+		c = compareExprNumbers(left, right, lf, rf)
+	default:
+		return nil, fmt.Errorf("operator %s is not supported for %T and %T", n.op, left, right)
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// compareExprNumbers compares two numbers, using integer comparison when both are integers to avoid precision loss
+func compareExprNumbers(left, right any, lf, rf float64) int {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return cmp.Compare(l, r)
+		}
+	}
+	return cmp.Compare(lf, rf)
+}
+
+// exprEqual compares two evaluator values for equality
+func exprEqual(left, right any) (bool, error) {
+	if left == nil || right == nil {
+		return left == nil && right == nil, nil
+	}
+	lf, lNum := toExprFloat(left)
+	rf, rNum := toExprFloat(right)
+	if lNum && rNum {
+		return compareExprNumbers(left, right, lf, rf) == 0, nil
+	}
+	switch l := left.(type) {
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("can not compare %T with %T", left, right)
+		}
+		return l == r, nil
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return false, fmt.Errorf("can not compare %T with %T", left, right)
+		}
+		return l == r, nil
+	default:
+		return false, fmt.Errorf("can not compare %T with %T", left, right)
+	}
+}
+
+type inNode struct {
+	left, right exprNode
+}
+
+func (n *inNode) eval(v reflect.Value) (any, error) {
+	left, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := right.([]any)
+	if !ok {
+		return nil, fmt.Errorf("operator in requires a list, got %T", right)
+	}
+	for _, item := range list {
+		equal, err := exprEqual(left, item)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			return true, nil
+		}
+	}
+	return false, nil
+}
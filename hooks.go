@@ -0,0 +1,78 @@
+package defcon
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Validator is implemented by structs that validate invariants too complex to express in annotations.
+// Validate is called after all fields of the struct have been processed.
+type Validator interface {
+	Validate() error
+}
+
+// Defaulter is implemented by structs that set their own default values.
+// SetDefaults is called before any annotations of the struct's fields are processed.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// Checker is implemented by config structs with a check method generated by defcon-gen.
+// CheckStruct calls DefconCheck instead of walking the struct with reflection when it is present.
+type Checker interface {
+	DefconCheck() error
+}
+
+// FieldError is returned when validation of a field or struct fails, carrying the path of the field from the root struct
+type FieldError struct {
+	Path string // Path of the field from the root struct, e.g. "Backends[0].TLS", empty for the root struct
+	Err  error  // The underlying validation error
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// getInterface returns the struct value as an interface, preferring a pointer so that methods with pointer receivers are found
+func getInterface(val *reflect.Value) (any, bool) {
+	if val.CanAddr() && val.Addr().CanInterface() {
+		return val.Addr().Interface(), true
+	}
+	if val.CanInterface() {
+		return val.Interface(), true
+	}
+	return nil, false
+}
+
+// callDefaulter calls SetDefaults on the struct if it implements Defaulter
+func callDefaulter(val *reflect.Value) {
+	i, ok := getInterface(val)
+	if !ok {
+		return
+	}
+	if d, ok := i.(Defaulter); ok {
+		d.SetDefaults()
+	}
+}
+
+// callValidator calls Validate on the struct if it implements Validator and attributes any error to the struct's path
+func callValidator(s *state, val *reflect.Value) error {
+	i, ok := getInterface(val)
+	if !ok {
+		return nil
+	}
+	if v, ok := i.(Validator); ok {
+		err := v.Validate()
+		if err != nil {
+			return &FieldError{Path: s.path, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package defcon
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// interfaceField handles interface fields, structs held by them are processed with their own annotations.
+// With the "oneoftype" annotation the concrete type is selected by a discriminator in JSON objects given by defaults, environment variables or decoders.
+type interfaceField struct{}
+
+func (f *interfaceField) handle(s *state, val *reflect.Value, annotations *annotations) error {
+
+	// Annotations that parse or inspect the value of the field, defaults and environment variables take a JSON object if the type can be selected
+	for _, annotation := range []struct {
+		key   string
+		found bool
+	}{
+		{"default", annotations.DefaultValue != "" && annotations.OneOfType == ""},
+		{"env", annotations.EnvVarName != "" && annotations.OneOfType == ""},
+		{"musthave", len(annotations.MustHave) > 0},
+		{"unique", annotations.Unique},
+		{"alwayshas", len(annotations.AlwaysHas) > 0},
+		{"mustmatch", annotations.MustMatch != nil},
+		{"mustnotmatch", annotations.MustNotMatch != nil},
+		{"validrange", annotations.ValidRange != ""},
+	} {
+		if annotation.found {
+			return fmt.Errorf("%s annotation is not supported on fields of type %s", annotation.key, val.Type())
+		}
+	}
+
+	// Manage env var
+	present := false
+	if annotations.EnvVarName != "" && val.IsZero() {
+		envValue, found := s.opts.lookupEnv(annotations.EnvVarName)
+		if found {
+			err := f.setOneOf(val, annotations.OneOfType, []byte(envValue))
+			if err != nil {
+				return fmt.Errorf("failed to set value from environment variable: %v", err)
+			}
+			s.setSource("env:"+annotations.EnvVarName, envValue)
+			present = true
+		}
+	}
+
+	// Handle default values
+	if annotations.DefaultValue != "" && val.IsZero() && !present {
+		err := f.setOneOf(val, annotations.OneOfType, []byte(annotations.DefaultValue))
+		if err != nil {
+			return fmt.Errorf("failed to set default value: %v", err)
+		}
+		s.setSource(SourceDefault, annotations.DefaultValue)
+	}
+
+	// Objects decoded into fields of type any, e.g. map[string]any from encoding/json, are converted to the selected type
+	if annotations.OneOfType != "" && !val.IsNil() && val.Elem().Kind() == reflect.Map {
+		data, err := json.Marshal(val.Elem().Interface())
+		if err != nil {
+			return fmt.Errorf("failed to convert value of type %s: %v", val.Elem().Type(), err)
+		}
+		err = f.setOneOf(val, annotations.OneOfType, data)
+		if err != nil {
+			return fmt.Errorf("failed to convert value: %v", err)
+		}
+	}
+
+	// Manage required field
+	if annotations.Required && val.IsZero() {
+		return fmt.Errorf("field is marked as required but has no value")
+	}
+
+	// Process structs held by the interface, values are copied to be settable and stored back
+	if !val.IsNil() {
+		elem := val.Elem()
+		switch {
+		case elem.Kind() == reflect.Pointer && !elem.IsNil() && elem.Elem().Kind() == reflect.Struct:
+			// Structs are processed once, pointers back to a struct that is already processed would otherwise recurse forever
+			if !s.opts.visited.add(elem) {
+				break
+			}
+			target := elem.Elem()
+			err := (&structField{}).handle(s, &target, nil)
+			if err != nil {
+				return err
+			}
+		case elem.Kind() == reflect.Struct:
+			target := reflect.New(elem.Type()).Elem()
+			target.Set(elem)
+			err := (&structField{}).handle(s, &target, nil)
+			if err != nil {
+				return err
+			}
+			val.Set(target)
+		}
+	}
+
+	// Manage named validators
+	if len(annotations.Validators) > 0 && !val.IsZero() {
+		err := runValidators(*val, annotations)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setOneOf sets the field to a value of the type selected by the discriminator of a JSON object
+func (f *interfaceField) setOneOf(val *reflect.Value, key string, data []byte) error {
+	v, err := decodeOneOf(val.Type(), key, data)
+	if err != nil {
+		return err
+	}
+	val.Set(v)
+	return nil
+}
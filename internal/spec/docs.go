@@ -0,0 +1,95 @@
+package spec
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// docColumns lists the columns of generated documentation
+var docColumns = []string{"Field", "Type", "Env", "Default", "Required", "Range", "Pattern", "Description"}
+
+// isCode returns true if values in the column are rendered as code
+func isCode(column string) bool {
+	return column != "Required" && column != "Description"
+}
+
+// docRow returns the column values of a field, empty strings for annotations that are not set
+func docRow(f Field) []string {
+
+	required := ""
+	if f.Bool("required") {
+		required = "yes"
+	}
+
+	patterns := []string{}
+	if mustMatch := f.Lookup("mustmatch"); mustMatch != "" {
+		patterns = append(patterns, mustMatch)
+	}
+	if mustNotMatch := f.Lookup("mustnotmatch"); mustNotMatch != "" {
+		patterns = append(patterns, "not "+mustNotMatch)
+	}
+
+	def := f.Lookup("default")
+	if from := f.Lookup("defaultfrom"); from != "" && def == "" {
+		def = "from " + from
+	}
+	if f.Bool("secret") && def != "" {
+		def = "[REDACTED]"
+	}
+
+	return []string{f.Path, f.Type, f.Lookup("env"), def, required, f.Lookup("validrange"), strings.Join(patterns, ", "), f.Lookup("desc")}
+}
+
+// WriteMarkdown writes the fields as a Markdown table
+func WriteMarkdown(w io.Writer, fields []Field) error {
+
+	_, err := fmt.Fprintf(w, "| %s |\n|%s\n", strings.Join(docColumns, " | "), strings.Repeat(":---|", len(docColumns)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		cells := []string{}
+		for i, value := range docRow(f) {
+			value = strings.ReplaceAll(value, "|", `\|`)
+			if value != "" && isCode(docColumns[i]) {
+				value = "`" + value + "`"
+			}
+			cells = append(cells, value)
+		}
+		_, err = fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteHTML writes the fields as an HTML table
+func WriteHTML(w io.Writer, fields []Field) error {
+
+	var b strings.Builder
+	b.WriteString("<table>\n  <thead>\n    <tr>")
+	for _, column := range docColumns {
+		fmt.Fprintf(&b, "<th>%s</th>", column)
+	}
+	b.WriteString("</tr>\n  </thead>\n  <tbody>\n")
+	for _, f := range fields {
+		b.WriteString("    <tr>")
+		for i, value := range docRow(f) {
+			value = html.EscapeString(value)
+			if value != "" && isCode(docColumns[i]) {
+				value = "<code>" + value + "</code>"
+			}
+			fmt.Fprintf(&b, "<td>%s</td>", value)
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("  </tbody>\n</table>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,129 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// envFields returns the fields annotated with an environment variable, each variable only once
+func envFields(fields []Field) []Field {
+	seen := map[string]bool{}
+	result := []Field{}
+	for _, f := range fields {
+		env := strings.TrimSpace(f.Lookup("env"))
+		if env == "" || seen[env] {
+			continue
+		}
+		seen[env] = true
+		result = append(result, f)
+	}
+	return result
+}
+
+// envValue returns the example value of a field, secrets never get their default value written
+func envValue(f Field) string {
+	if f.Bool("secret") {
+		return ""
+	}
+	return f.Lookup("default")
+}
+
+// quote quotes a value for YAML, using JSON string syntax which is a valid YAML double quoted scalar
+func quote(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// WriteEnvExample writes a commented .env.example file with defaults filled in and required variables flagged
+func WriteEnvExample(w io.Writer, fields []Field) error {
+
+	var b strings.Builder
+	for i, f := range envFields(fields) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s (%s)\n", f.Path, f.Type)
+		if desc := f.Lookup("desc"); desc != "" {
+			fmt.Fprintf(&b, "# %s\n", desc)
+		}
+		if f.Bool("required") {
+			b.WriteString("# Required\n")
+		}
+		if f.Bool("secret") {
+			b.WriteString("# Secret\n")
+		}
+		fmt.Fprintf(&b, "%s=%s\n", strings.TrimSpace(f.Lookup("env")), envValue(f))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteKubernetesEnv writes the "env:" section of a Kubernetes container spec, secrets reference a Secret with the given name
+func WriteKubernetesEnv(w io.Writer, fields []Field, secretName string) error {
+
+	var b strings.Builder
+	b.WriteString("env:\n")
+	for _, f := range envFields(fields) {
+		env := strings.TrimSpace(f.Lookup("env"))
+		if desc := f.Lookup("desc"); desc != "" {
+			fmt.Fprintf(&b, "  # %s\n", desc)
+		}
+		if f.Bool("required") && envValue(f) == "" && !f.Bool("secret") {
+			b.WriteString("  # Required\n")
+		}
+		fmt.Fprintf(&b, "  - name: %s\n", env)
+		if f.Bool("secret") {
+			fmt.Fprintf(&b, "    valueFrom:\n      secretKeyRef:\n        name: %s\n        key: %s\n", secretName, env)
+			continue
+		}
+		fmt.Fprintf(&b, "    value: %s\n", quote(envValue(f)))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteConfigMap writes a Kubernetes ConfigMap holding all non-secret environment variables
+func WriteConfigMap(w io.Writer, fields []Field, name string) error {
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n", name)
+	for _, f := range envFields(fields) {
+		if f.Bool("secret") {
+			continue
+		}
+		if f.Bool("required") && envValue(f) == "" {
+			b.WriteString("  # Required\n")
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", strings.TrimSpace(f.Lookup("env")), quote(envValue(f)))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// KebabCase converts a Go type name to a Kubernetes resource name, e.g. "ServerConfig" to "server-config"
+func KebabCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word at an upper case letter following a lower case letter, or ending an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteRune('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		if r == '_' {
+			b.WriteRune('-')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
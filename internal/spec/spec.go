@@ -0,0 +1,38 @@
+// Package spec holds a flat description of annotated config fields, shared by the reflection based generators in defcon and the source based generators in cmd/defcon
+package spec
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// Field describes a single leaf field of a config struct
+type Field struct {
+	Path string            // Path of the field from the root struct, elements of slices of structs are written as "Backends[].Host"
+	Type string            // Go type of the field as written, e.g. "[]string" or "time.Duration"
+	Tag  reflect.StructTag // Struct tag holding the field's annotations
+}
+
+// Lookup returns the value of an annotation
+func (f Field) Lookup(key string) string {
+	value, _ := f.Tag.Lookup(key)
+	return value
+}
+
+// Bool returns the boolean value of an annotation, false if not set or not a boolean
+func (f Field) Bool(key string) bool {
+	value, found := f.Tag.Lookup(key)
+	if !found {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	return err == nil && b
+}
+
+// Join returns the path of a named field of the struct at path
+func Join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
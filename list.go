@@ -0,0 +1,123 @@
+package defcon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseList splits a list value as used in defaults, environment variables and the "musthave" and "alwayshas" annotations into its elements.
+// Accepted forms are elements separated by commas or newlines, optionally enclosed in braces, e.g. "a, b", "{a, b}" or one element per line,
+// and JSON arrays of strings, numbers and booleans, e.g. `["a", "b"]`.
+// Elements are trimmed and empty elements are skipped. Elements can be quoted with double quotes to keep separators, surrounding whitespace
+// and empty strings, Go escape sequences such as \" and \n are supported within quotes.
+// A non-empty sep, as given by the "sep" annotation, replaces commas and newlines as the separator.
+// It is used by CheckStruct and by code generated by defcon-gen.
+func ParseList(val, sep string) ([]string, error) {
+
+	val = strings.TrimSpace(val)
+	if strings.HasPrefix(val, "[") && strings.HasSuffix(val, "]") {
+		return parseJSONList(val)
+	}
+	if strings.HasPrefix(val, "{") && strings.HasSuffix(val, "}") {
+		val = val[1 : len(val)-1]
+	}
+
+	separators := []string{",", "\n"}
+	if sep != "" {
+		separators = []string{sep}
+	}
+
+	// Whitespace around elements is trimmed, unless it is part of a separator, e.g. sep:" "
+	isSpace := func(r rune) bool {
+		return unicode.IsSpace(r) && !slices.ContainsFunc(separators, func(separator string) bool {
+			return strings.ContainsRune(separator, r)
+		})
+	}
+
+	// nextSeparator returns the index and length of the first separator, or the end of the value if there is none
+	nextSeparator := func(s string) (int, int) {
+		index, length := len(s), 0
+		for _, separator := range separators {
+			if i := strings.Index(s, separator); i >= 0 && i < index {
+				index, length = i, len(separator)
+			}
+		}
+		return index, length
+	}
+
+	values := []string{}
+	rest := val
+	for {
+		rest = strings.TrimLeftFunc(rest, isSpace)
+
+		quoted := strings.HasPrefix(rest, `"`)
+		var value string
+		if quoted {
+			prefix, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("list value '%s' has an invalid quoted element", val)
+			}
+			value, _ = strconv.Unquote(prefix)
+			rest = strings.TrimLeftFunc(rest[len(prefix):], isSpace)
+		}
+
+		i, length := nextSeparator(rest)
+		if quoted {
+			if i > 0 {
+				return nil, fmt.Errorf("list value '%s' has unexpected text '%s' after a quoted element", val, rest[:i])
+			}
+			values = append(values, value)
+		} else if value = strings.TrimSpace(rest[:i]); value != "" {
+			values = append(values, value)
+		}
+
+		if length == 0 {
+			return values, nil
+		}
+		rest = rest[i+length:]
+	}
+}
+
+// parseJSONList returns the elements of a JSON array as strings, as they would be written in a plain list
+func parseJSONList(val string) ([]string, error) {
+
+	decoder := json.NewDecoder(strings.NewReader(val))
+	decoder.UseNumber() // Keep numbers as written, e.g. large integers
+	elements := []any{}
+	err := decodeJSON(decoder, &elements)
+	if err != nil {
+		return nil, fmt.Errorf("list value '%s' is not a valid JSON array: %s", val, err)
+	}
+
+	values := make([]string, 0, len(elements))
+	for _, element := range elements {
+		switch e := element.(type) {
+		case string:
+			values = append(values, e)
+		case json.Number:
+			values = append(values, e.String())
+		case bool:
+			values = append(values, strconv.FormatBool(e))
+		default:
+			return nil, fmt.Errorf("list value '%s' is a JSON array with elements other than strings, numbers and booleans", val)
+		}
+	}
+	return values, nil
+}
+
+// decodeJSON decodes a single JSON value, data after the value is reported as an error
+func decodeJSON(decoder *json.Decoder, v any) error {
+	err := decoder.Decode(v)
+	if err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+	return nil
+}
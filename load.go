@@ -0,0 +1,42 @@
+package defcon
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Load returns a new config of type T, populated from the files given by WithFiles, environment variables and defaults and validated with CheckStruct.
+// T must be a struct type.
+func Load[T any](opts ...Option) (T, error) {
+
+	var config T
+
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return config, fmt.Errorf("can not load config of type %s, expected a struct", t)
+	}
+
+	o := newOptions(opts)
+	for _, file := range o.files {
+		_, err := decodeFile(file, &config, o)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	err := CheckStruct(&config, opts...)
+	if err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// MustLoad is like Load but panics if the config can not be loaded, for use in program initialization
+func MustLoad[T any](opts ...Option) T {
+	config, err := Load[T](opts...)
+	if err != nil {
+		panic(fmt.Sprintf("defcon: failed to load config: %s", err))
+	}
+	return config
+}
@@ -2,7 +2,6 @@ package defcon
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 	"slices"
 
@@ -11,30 +10,36 @@ import (
 
 type numericField struct{}
 
-func (f *numericField) handle(val *reflect.Value, annotations *annotations) error {
+func (f *numericField) handle(s *state, val *reflect.Value, annotations *annotations) error {
+
+	// Tracks if the value was explicitly provided, so that zero values from environment variables are kept
+	present := false
 
 	// Manage environment variables
 	if annotations.EnvVarName != "" && val.IsZero() {
-		envValue, found := os.LookupEnv(annotations.EnvVarName)
+		envValue, found := s.opts.lookupEnv(annotations.EnvVarName)
 		if found {
-			err := setValue(val, envValue)
+			err := setValue(val, envValue, s.listFormat(annotations))
 			if err != nil {
 				return fmt.Errorf("failed to set value from environment variable: %v", err)
 			}
+			s.setSource("env:"+annotations.EnvVarName, envValue)
+			present = true
 		}
 	}
 
 	// Manage default values
-	if annotations.DefaultValue != "" && val.IsZero() {
-		err := setValue(val, annotations.DefaultValue)
+	if annotations.DefaultValue != "" && val.IsZero() && !present {
+		err := setValue(val, annotations.DefaultValue, s.listFormat(annotations))
 		if err != nil {
 			return fmt.Errorf("failed to set default value: %v", err)
 		}
+		s.setSource(SourceDefault, annotations.DefaultValue)
 	}
 
 	// Manage required field
 	if annotations.Required {
-		if val.IsZero() {
+		if val.IsZero() && !present {
 			// Return an error if the field is required but has no value
 			return fmt.Errorf("field is marked as required but has no value")
 		}
@@ -59,5 +64,13 @@ func (f *numericField) handle(val *reflect.Value, annotations *annotations) erro
 		}
 
 	}
+	// Manage named validators
+	if len(annotations.Validators) > 0 && !val.IsZero() {
+		err := runValidators(*val, annotations)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
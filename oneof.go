@@ -0,0 +1,186 @@
+package defcon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Registry of concrete types selectable by the "oneoftype" annotation, keyed by kind
+var (
+	oneOfTypesMu sync.RWMutex
+	oneOfTypes   = map[string][]reflect.Type{}
+)
+
+// RegisterType registers the type of v, e.g. &S3Config{}, under a kind for interface fields annotated with "oneoftype".
+// A kind can be shared by types implementing different interfaces, the type implementing the interface of the field is used.
+// Pointer types should be registered so that decoders can decode config files into the allocated value.
+func RegisterType(kind string, v any) error {
+
+	if strings.TrimSpace(kind) == "" {
+		return fmt.Errorf("kind must not be empty")
+	}
+	if v == nil {
+		return fmt.Errorf("kind %s has no type", kind)
+	}
+	t := reflect.TypeOf(v)
+
+	oneOfTypesMu.Lock()
+	defer oneOfTypesMu.Unlock()
+
+	for _, registered := range oneOfTypes[kind] {
+		if registered == t {
+			return fmt.Errorf("type %s is already registered as kind %s", t, kind)
+		}
+	}
+	oneOfTypes[kind] = append(oneOfTypes[kind], t)
+
+	return nil
+}
+
+// newOneOf allocates a value of the type registered for the kind that can be assigned to a field of the given interface type
+func newOneOf(kind string, field reflect.Type) (reflect.Value, error) {
+
+	oneOfTypesMu.RLock()
+	defer oneOfTypesMu.RUnlock()
+
+	for _, t := range oneOfTypes[kind] {
+		if !t.AssignableTo(field) {
+			continue
+		}
+		if t.Kind() == reflect.Pointer {
+			return reflect.New(t.Elem()), nil
+		}
+		return reflect.New(t).Elem(), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("no type implementing %s is registered as kind %s", field, kind)
+}
+
+// decodeOneOf decodes a JSON object into a new value of the type selected by the discriminator key of the object
+func decodeOneOf(field reflect.Type, key string, data []byte) (reflect.Value, error) {
+
+	object := map[string]any{}
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("expected a JSON object: %s", err)
+	}
+	kind, ok := object[key].(string)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("object has no %s of type string selecting its type", key)
+	}
+
+	v, err := newOneOf(kind, field)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	// Decode into a pointer, the discriminator is usually not a field of the type and is ignored
+	ptr := v
+	if v.Kind() != reflect.Pointer {
+		ptr = reflect.New(v.Type())
+	}
+	err = decodeJSON(json.NewDecoder(bytes.NewReader(data)), ptr.Interface())
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("failed to decode %s: %s", kind, err)
+	}
+	if v.Kind() != reflect.Pointer {
+		return ptr.Elem(), nil
+	}
+
+	return v, nil
+}
+
+// allocateOneOf sets interface fields annotated with "oneoftype" to a new value of the type selected by the discriminator in the decoded config file.
+// Decoders decode objects into pointers held by interfaces, which lets them fill in the concrete type. Fields are matched to the file as encoding/json does.
+func allocateOneOf(val reflect.Value, raw any) error {
+
+	object, ok := raw.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	f := structField{}
+	for i := 0; i < val.NumField(); i++ {
+
+		sf := val.Type().Field(i)
+		v := val.Field(i)
+
+		// Embedded structs are flattened by encoding/json
+		if tag, _, _ := strings.Cut(sf.Tag.Get("json"), ","); sf.Anonymous && tag == "" && v.Kind() == reflect.Struct {
+			err := allocateOneOf(v, raw)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+		name, ok := propertyName(sf)
+		if !ok {
+			continue
+		}
+		value, found := lookupProperty(object, name)
+		if !found {
+			continue
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			err := allocateOneOf(v, value)
+			if err != nil {
+				return err
+			}
+		case reflect.Interface:
+			annotations, err := f.getAnnotations(sf)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid annotation syntax: %s", sf.Name, err)
+			}
+			kind, ok := lookupKind(value, annotations.OneOfType)
+			if annotations.OneOfType == "" || !ok {
+				continue
+			}
+			allocated, err := newOneOf(kind, v.Type())
+			if err != nil {
+				return fmt.Errorf("field %s: %s", sf.Name, err)
+			}
+			// Values from earlier files are kept as long as the kind does not change
+			if !v.IsNil() && v.Elem().Type() == allocated.Type() {
+				continue
+			}
+			if allocated.Kind() == reflect.Pointer {
+				v.Set(allocated)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupProperty returns the value of a property of a decoded object, preferring an exact match of the name over a case-insensitive one
+func lookupProperty(object map[string]any, name string) (any, bool) {
+	if value, found := object[name]; found {
+		return value, true
+	}
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// lookupKind returns the discriminator of a decoded object
+func lookupKind(raw any, key string) (string, bool) {
+	object, ok := raw.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	kind, ok := object[key].(string)
+	return kind, ok
+}
@@ -0,0 +1,164 @@
+package defcon
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Optional wraps a value and records whether it has been explicitly set, allowing zero values such as 0, "" or false to be valid.
+// Annotations "required", "default" and "requires" use presence rather than the zero value to decide if an Optional field is set.
+type Optional[T any] struct {
+	value T
+	set   bool
+}
+
+// Some returns an Optional holding the given value
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{value: v, set: true}
+}
+
+// Get returns the value and whether it is set
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.set
+}
+
+// Value returns the value, or the zero value of T if it is not set
+func (o Optional[T]) Value() T {
+	return o.value
+}
+
+// IsSet returns true if a value has been explicitly set
+func (o Optional[T]) IsSet() bool {
+	return o.set
+}
+
+// Set sets the value and marks it as present
+func (o *Optional[T]) Set(v T) {
+	o.value = v
+	o.set = true
+}
+
+// Unset clears the value and marks it as absent
+func (o *Optional[T]) Unset() {
+	var zero T
+	o.value = zero
+	o.set = false
+}
+
+// MarshalJSON encodes an unset Optional as null
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+// UnmarshalJSON decodes null as unset and any other value as set
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		o.Unset()
+		return nil
+	}
+	err := json.Unmarshal(data, &o.value)
+	if err != nil {
+		return err
+	}
+	o.set = true
+	return nil
+}
+
+func (o *Optional[T]) optionalValue() reflect.Value {
+	return reflect.ValueOf(&o.value).Elem()
+}
+
+func (o *Optional[T]) isPresent() bool {
+	return o.set
+}
+
+func (o *Optional[T]) markPresent() {
+	o.set = true
+}
+
+// optional is implemented by pointers to Optional of any type
+type optional interface {
+	optionalValue() reflect.Value
+	isPresent() bool
+	markPresent()
+}
+
+var optionalType = reflect.TypeFor[optional]()
+
+// isOptional returns true if the type is an Optional
+func isOptional(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && reflect.PointerTo(t).Implements(optionalType)
+}
+
+// valueType returns the type held by an Optional type, other types are returned as is
+func valueType(t reflect.Type) reflect.Type {
+	if isOptional(t) {
+		return reflect.New(t).Interface().(optional).optionalValue().Type()
+	}
+	return t
+}
+
+// unwrapOptional returns the wrapped value of an Optional and whether it is set, other values are returned as is
+func unwrapOptional(v reflect.Value) (reflect.Value, bool) {
+	if !isOptional(v.Type()) || !v.CanAddr() {
+		return v, !v.IsZero()
+	}
+	o := v.Addr().Interface().(optional)
+	return o.optionalValue(), o.isPresent()
+}
+
+type optionalField struct{}
+
+func (f *optionalField) handle(s *state, val *reflect.Value, annotations *annotations) error {
+
+	o := val.Addr().Interface().(optional)
+	inner := o.optionalValue()
+
+	// Lookup environment variable if specified and value is not present
+	if annotations.EnvVarName != "" && !o.isPresent() {
+		envValue, found := s.opts.lookupEnv(annotations.EnvVarName)
+		if found {
+			err := setValue(&inner, envValue, s.listFormat(annotations))
+			if err != nil {
+				return fmt.Errorf("failed to set value from environment variable: %v", err)
+			}
+			s.setSource("env:"+annotations.EnvVarName, envValue)
+			o.markPresent()
+		}
+	}
+
+	// Manage default value
+	if annotations.DefaultValue != "" && !o.isPresent() {
+		err := setValue(&inner, annotations.DefaultValue, s.listFormat(annotations))
+		if err != nil {
+			return fmt.Errorf("failed to set default value: %v", err)
+		}
+		s.setSource(SourceDefault, annotations.DefaultValue)
+		o.markPresent()
+	}
+
+	// Manage required field
+	if annotations.Required && !o.isPresent() {
+		return fmt.Errorf("field is marked as required but has no value")
+	}
+
+	if !o.isPresent() {
+		return nil
+	}
+
+	// Validate the wrapped value with the handler of its type, presence has already been managed
+	fieldType, err := getType(inner)
+	if err != nil {
+		return fmt.Errorf("failed to get field type: %v", err)
+	}
+	validation := *annotations
+	validation.EnvVarName = ""
+	validation.DefaultValue = ""
+	validation.Required = false
+
+	return fieldType.handle(s, &inner, &validation)
+}
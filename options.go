@@ -0,0 +1,110 @@
+package defcon
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"time"
+)
+
+// Option configures the behaviour of CheckStruct, Load and Watcher
+type Option func(*options)
+
+// options holds the configuration of a single CheckStruct or Load call or Watcher
+type options struct {
+	report         *Report                        // Report to record the provenance of field values in, nil if not requested
+	lookupEnv      func(string) (string, bool)    // Lookup of environment variables, os.LookupEnv unless replaced
+	customEnv      bool                           // True if the lookup of environment variables has been replaced
+	interval       time.Duration                  // Polling interval of a Watcher
+	decode         func(data []byte, v any) error // Decoder of config files read by Load and Watcher
+	files          []string                       // Config files read by Load
+	padArrays      bool                           // True if defaults and environment variables may have fewer elements than a fixed-size array
+	skipUnexported bool                           // True if unexported fields are left untouched
+	requires       []func() error                 // Checks of "requires" tags, run by CheckStruct once all fields have been processed
+	visited        visits                         // Structs reached through pointers that have been processed by CheckStruct
+}
+
+// visit is a struct reached through a pointer, identified by its address and type as a struct and its first field share their address
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// visits are the structs reached through pointers while walking a config, to stop at cycles
+type visits map[visit]bool
+
+// add records the struct a pointer points to, returning false if it already has been
+func (v visits) add(ptr reflect.Value) bool {
+	key := visit{ptr: ptr.Pointer(), typ: ptr.Type()}
+	if v[key] {
+		return false
+	}
+	v[key] = true
+	return true
+}
+
+// newOptions applies all given options on top of the defaults
+func newOptions(opts []Option) *options {
+	o := &options{
+		visited:   visits{},
+		lookupEnv: os.LookupEnv,
+		interval:  5 * time.Second,
+		decode:    json.Unmarshal,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithReport records the source, raw value and final value of every field in the given report
+func WithReport(r *Report) Option {
+	return func(o *options) {
+		o.report = r
+	}
+}
+
+// WithLookupEnv replaces os.LookupEnv for looking up environment variables, e.g. to read them from a secrets store or in tests
+func WithLookupEnv(lookup func(key string) (string, bool)) Option {
+	return func(o *options) {
+		o.lookupEnv = lookup
+		o.customEnv = true
+	}
+}
+
+// WithInterval sets how often a Watcher polls its sources for changes, the default is 5 seconds. NewWatcher rejects intervals that are not positive.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+// WithDecoder sets the function Load and Watcher decode config files with, the default is json.Unmarshal
+func WithDecoder(decode func(data []byte, v any) error) Option {
+	return func(o *options) {
+		o.decode = decode
+	}
+}
+
+// WithFiles adds config files for Load to read, files are decoded in order on top of each other before environment variables and defaults are applied
+func WithFiles(files ...string) Option {
+	return func(o *options) {
+		o.files = append(o.files, files...)
+	}
+}
+
+// WithSkipUnexported leaves unexported fields untouched, they are neither set nor validated and structs in them are not descended into.
+// Embedded structs of unexported types are still descended into, as their exported fields are promoted. By default unexported fields are processed like exported ones.
+func WithSkipUnexported() Option {
+	return func(o *options) {
+		o.skipUnexported = true
+	}
+}
+
+// WithArrayPadding allows defaults and environment variables with fewer elements than the length of a fixed-size array, the remaining elements are left at their zero value.
+// By default they must have exactly as many elements as the array.
+func WithArrayPadding() Option {
+	return func(o *options) {
+		o.padArrays = true
+	}
+}
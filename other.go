@@ -0,0 +1,47 @@
+package defcon
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// otherField handles fields of kinds without a specific handler, e.g. maps, pointers and channels.
+// Their values are not parsed or inspected, annotations that need to do so are reported as errors.
+type otherField struct{}
+
+func (f *otherField) handle(s *state, val *reflect.Value, annotations *annotations) error {
+
+	// Annotations that parse or inspect the value of the field
+	for _, annotation := range []struct {
+		key   string
+		found bool
+	}{
+		{"default", annotations.DefaultValue != ""},
+		{"env", annotations.EnvVarName != ""},
+		{"musthave", len(annotations.MustHave) > 0},
+		{"unique", annotations.Unique},
+		{"alwayshas", len(annotations.AlwaysHas) > 0},
+		{"mustmatch", annotations.MustMatch != nil},
+		{"mustnotmatch", annotations.MustNotMatch != nil},
+		{"validrange", annotations.ValidRange != ""},
+	} {
+		if annotation.found {
+			return fmt.Errorf("%s annotation is not supported on fields of type %s", annotation.key, val.Type())
+		}
+	}
+
+	// Manage required field
+	if annotations.Required && val.IsZero() {
+		return fmt.Errorf("field is marked as required but has no value")
+	}
+
+	// Manage named validators
+	if len(annotations.Validators) > 0 && !val.IsZero() {
+		err := runValidators(*val, annotations)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
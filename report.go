@@ -0,0 +1,116 @@
+package defcon
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Sources of field values recorded in a Report
+const (
+	SourcePreset    = "preset"    // Value was set in the struct before it was checked
+	SourceDefault   = "default"   // Value was set from the "default" annotation
+	SourceAlwaysHas = "alwayshas" // Values were appended by the "alwayshas" annotation
+	SourceUnset     = "unset"     // Field has no value
+)
+
+// FieldSource describes where the value of a field came from
+type FieldSource struct {
+	Path   string // Path of the field from the root struct, e.g. "Backends[0].Host"
+	Source string // Source of the value, e.g. "env:DB_HOST", "default", "defaultfrom:ListenHost", "preset", "preset+alwayshas" or "unset"
+	Raw    string // Raw string the value was parsed from, empty for preset and unset values, Redacted for secret fields
+	Value  any    // Final value of the field after all annotations have been processed, Redacted for secret fields
+}
+
+// Report maps field paths to the source of their values, in the order the fields were processed
+type Report struct {
+	Fields []FieldSource
+}
+
+// Get returns the source of the field with the given path
+func (r *Report) Get(path string) (FieldSource, bool) {
+	for _, field := range r.Fields {
+		if field.Path == path {
+			return field, true
+		}
+	}
+	return FieldSource{}, false
+}
+
+// String formats the report as an aligned table, suitable for logging at startup
+func (r *Report) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tSOURCE\tRAW\tVALUE")
+	for _, field := range r.Fields {
+		fmt.Fprintf(w, "%s\t%s\t%q\t%v\n", field.Path, field.Source, field.Raw, field.Value)
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// isLeaf returns true if a value is recorded as a single entry in a report, nested structs and slices of structs are recorded per field
+func isLeaf(v reflect.Value) bool {
+	if isOptional(v.Type()) || isOpaque(v.Type()) {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return false
+	case reflect.Slice, reflect.Array:
+		return !isStructList(v.Type())
+	default:
+		return true
+	}
+}
+
+// reportValue returns the value of a field as recorded in a report
+func reportValue(v reflect.Value) any {
+	if isOptional(v.Type()) && v.CanAddr() {
+		inner, present := unwrapOptional(v)
+		if !present {
+			return nil
+		}
+		v = inner
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// containsSecrets returns true if a value holds fields annotated with `secret:"true"`, in nested structs, pointers, slices, arrays or maps.
+// Such values are redacted where they are recorded or printed as a whole. Invalid secret annotations count as secret.
+func containsSecrets(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return hasSecrets(v.Type(), map[reflect.Type]bool{})
+}
+
+// hasSecrets returns true if a type has fields annotated with `secret:"true"`, types already seen are skipped to allow recursive types
+func hasSecrets(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return hasSecrets(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if value, found := sf.Tag.Lookup("secret"); found {
+				if secret, err := strconv.ParseBool(value); secret || err != nil {
+					return true
+				}
+			}
+			if hasSecrets(sf.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,375 @@
+package defcon
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaDraft is the JSON Schema dialect generated by JSONSchema
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema generates a JSON Schema (draft 2020-12) for a config struct type, for validating config files in editors and CI.
+// Annotations are mapped to their schema equivalents; "required" to required unless the field has a default or environment variable,
+// "default" to default, "validrange" to minimum/maximum/enum accepting 0 for fields where CheckStruct treats 0 as unset,
+// "mustmatch" to pattern, "mustnotmatch" to not pattern, "alwayshas" and "musthave" to contains, "unique" to uniqueItems and "desc" to description.
+// Optional fields also accept null, time.Time is a date-time string and types marshaling themselves accept strings or, for json.Marshaler, any value.
+// Named nested structs are placed in $defs. Property names are taken from json tags if present, otherwise the field name.
+func JSONSchema(cfg any) ([]byte, error) {
+
+	t := reflect.TypeOf(cfg)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can not generate schema for %v, expected a struct", t)
+	}
+
+	g := &schemaGenerator{defs: map[string]any{}, names: map[reflect.Type]string{}}
+	root, err := g.structSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	root["$schema"] = schemaDraft
+	if t.Name() != "" {
+		root["title"] = t.Name()
+	}
+	if len(g.defs) > 0 {
+		root["$defs"] = g.defs
+	}
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaGenerator holds the definitions of named struct types while generating a schema
+type schemaGenerator struct {
+	defs  map[string]any          // Schemas of named struct types, referenced from $ref
+	names map[reflect.Type]string // Names of the definitions of named struct types
+}
+
+// propertyName returns the name of a field in config files, honoring json tags
+func propertyName(sf reflect.StructField) (string, bool) {
+	tag, found := sf.Tag.Lookup("json")
+	if !found {
+		return sf.Name, true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return sf.Name, true
+	default:
+		return name, true
+	}
+}
+
+// structSchema returns the schema of a struct type with one property per exported field
+func (g *schemaGenerator) structSchema(t reflect.Type) (map[string]any, error) {
+
+	f := structField{}
+	properties := map[string]any{}
+	required := []string{}
+
+	embedded := []map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		// Embedded structs without a name in their json tag are flattened by encoding/json, even if their type is unexported
+		if tag, _, _ := strings.Cut(sf.Tag.Get("json"), ","); sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct && !isOptional(sf.Type) {
+			schema, err := g.structSchema(sf.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %s", sf.Name, err)
+			}
+			embedded = append(embedded, schema)
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+		name, ok := propertyName(sf)
+		if !ok {
+			continue
+		}
+
+		annotations, err := f.getAnnotations(sf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation syntax on field %s: %s", sf.Name, err)
+		}
+		property, err := g.fieldSchema(sf.Type, annotations)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", sf.Name, err)
+		}
+		properties[name] = property
+		// Fields filled in by CheckStruct may be missing from config files
+		if annotations.Required && annotations.DefaultValue == "" && annotations.EnvVarName == "" && annotations.DefaultFromField == "" {
+			required = append(required, name)
+		}
+	}
+
+	// Promoted properties do not replace properties of the struct itself
+	for _, schema := range embedded {
+		embeddedRequired, _ := schema["required"].([]string)
+		embeddedProperties := schema["properties"].(map[string]any)
+		for _, name := range slices.Sorted(maps.Keys(embeddedProperties)) { // Sorted for a stable order of required properties
+			if _, found := properties[name]; !found {
+				properties[name] = embeddedProperties[name]
+				if slices.Contains(embeddedRequired, name) {
+					required = append(required, name)
+				}
+			}
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema, nil
+}
+
+// typeSchema returns the schema of a type without annotations, named structs are added to $defs and referenced
+func (g *schemaGenerator) typeSchema(t reflect.Type) (map[string]any, error) {
+
+	if isOptional(t) {
+		return g.typeSchema(valueType(t))
+	}
+
+	// time.Duration is an integer of nanoseconds
+	if t == reflect.TypeFor[time.Duration]() {
+		return map[string]any{"type": "integer"}, nil
+	}
+
+	// Types marshaling themselves are encoded as text, or in a form that can not be derived from their fields
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	}
+	if implements(t, reflect.TypeFor[encoding.TextMarshaler]()) {
+		return map[string]any{"type": "string"}, nil
+	}
+	if implements(t, reflect.TypeFor[json.Marshaler]()) {
+		return map[string]any{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		schema := map[string]any{"type": "array", "items": items}
+		if t.Kind() == reflect.Array {
+			schema["minItems"] = t.Len()
+			schema["maxItems"] = t.Len()
+		}
+		return schema, nil
+	case reflect.Map:
+		values, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem())
+	case reflect.Interface:
+		return map[string]any{}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name, found := g.names[t]
+		if !found {
+			name = g.defName(t)
+			g.names[t] = name
+			g.defs[name] = map[string]any{} // Placeholder to allow recursive types
+			schema, err := g.structSchema(t)
+			if err != nil {
+				return nil, err
+			}
+			g.defs[name] = schema
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}, nil
+	default:
+		return nil, fmt.Errorf("type %s is not supported in schemas", t)
+	}
+}
+
+// defName returns a unique definition name for a named struct type
+func (g *schemaGenerator) defName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := g.defs[name]; taken {
+		name = strings.NewReplacer("/", "_", ".", "_").Replace(t.PkgPath()) + "_" + name
+	}
+	return name
+}
+
+// fieldSchema returns the schema of a struct field, applying its annotations
+func (g *schemaGenerator) fieldSchema(t reflect.Type, annotations *annotations) (map[string]any, error) {
+
+	schema, err := g.typeSchema(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if annotations.Desc != "" {
+		// Siblings of $ref are allowed in draft 2020-12
+		schema["description"] = annotations.Desc
+	}
+
+	if annotations.DefaultValue != "" {
+		def, err := schemaDefault(t, annotations.DefaultValue, annotations.Sep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default value: %s", err)
+		}
+		schema["default"] = def
+	}
+
+	// Value constraints apply to the elements of slices
+	elements := schema
+	if items, ok := schema["items"].(map[string]any); ok {
+		elements = items
+	}
+
+	if annotations.ValidRange != "" {
+		// Zero integers and zero elements of arrays are unset and not checked against the range by CheckStruct, elements of slices are always checked
+		allowZero := !isOptional(t) && t.Kind() != reflect.Slice
+		err = applyRange(elements, annotations.ValidRange, allowZero)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if annotations.MustMatch != nil {
+		elements["pattern"] = annotations.MustMatch.String()
+	}
+	if annotations.MustNotMatch != nil {
+		elements["not"] = map[string]any{"pattern": annotations.MustNotMatch.String()}
+	}
+
+	if schema["type"] == "array" {
+		if annotations.Unique {
+			schema["uniqueItems"] = true
+		}
+		contains := []any{}
+		for _, value := range append(annotations.MustHave, annotations.AlwaysHas...) {
+			element, err := createTypeFromValue(reflect.New(valueType(t).Elem()).Elem(), value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %s: %s", value, err)
+			}
+			contains = append(contains, map[string]any{"contains": map[string]any{"const": element.Interface()}})
+		}
+		switch len(contains) {
+		case 0:
+		case 1:
+			schema["contains"] = contains[0].(map[string]any)["contains"]
+		default:
+			schema["allOf"] = contains
+		}
+	}
+
+	// Unset Optional fields are encoded as null
+	if isOptional(t) {
+		if enum, ok := schema["enum"].([]any); ok {
+			schema["enum"] = append(enum, nil)
+		}
+		switch typ := schema["type"].(type) {
+		case string:
+			schema["type"] = []any{typ, "null"}
+		case nil:
+			if len(schema) > 0 {
+				wrapped := map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+				for _, key := range []string{"description", "default"} {
+					if value, found := schema[key]; found {
+						wrapped[key] = value
+						delete(schema, key)
+					}
+				}
+				schema = wrapped
+			}
+		}
+	}
+
+	return schema, nil
+}
+
+// implements returns true if a type or a pointer to it implements an interface
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// schemaDefault parses a default annotation into a value of the field's type
+func schemaDefault(t reflect.Type, value, sep string) (any, error) {
+	v := reflect.New(valueType(t)).Elem()
+	err := setValue(&v, value, listFormat{sep: sep, pad: true}) // Padding depends on the options given to CheckStruct, allow it to show the default
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// applyRange maps a validrange annotation, e.g. "1-10, 44, 100-200", to minimum/maximum for a single range, enum for single values or anyOf for combinations.
+// If allowZero is set, 0 is accepted in addition to the range.
+func applyRange(schema map[string]any, validRange string, allowZero bool) error {
+
+	ranges := []any{}
+	values := []any{}
+	hasZero := false
+	for _, part := range splitList(validRange) {
+		// Search for the range separator after the first character to allow negative lower bounds
+		if idx := strings.Index(part[1:], "-"); idx >= 0 {
+			low, err := strconv.ParseInt(strings.TrimSpace(part[:idx+1]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid range %s: %s", part, err)
+			}
+			high, err := strconv.ParseInt(strings.TrimSpace(part[idx+2:]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid range %s: %s", part, err)
+			}
+			ranges = append(ranges, map[string]any{"minimum": low, "maximum": high})
+			hasZero = hasZero || (low <= 0 && high >= 0)
+		} else {
+			value, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid range value %s: %s", part, err)
+			}
+			values = append(values, value)
+			hasZero = hasZero || value == 0
+		}
+	}
+	if allowZero && !hasZero {
+		values = append(values, int64(0))
+	}
+
+	switch {
+	case len(ranges) == 1 && len(values) == 0:
+		for key, value := range ranges[0].(map[string]any) {
+			schema[key] = value
+		}
+	case len(ranges) == 0:
+		schema["enum"] = values
+	default:
+		if len(values) > 0 {
+			ranges = append(ranges, map[string]any{"enum": values})
+		}
+		schema["anyOf"] = ranges
+	}
+
+	return nil
+}
@@ -2,7 +2,6 @@ package defcon
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 	"slices"
 
@@ -11,9 +10,44 @@ import (
 
 type sliceField struct{}
 
-func (f *sliceField) handle(val *reflect.Value, annotations *annotations) error {
-	// Check if the slice contains structs
-	if val.Len() > 0 && val.Index(0).Kind() == reflect.Struct {
+func (f *sliceField) handle(s *state, val *reflect.Value, annotations *annotations) error {
+
+	// Tracks if the value was explicitly provided, so that zero values from environment variables are kept
+	present := false
+
+	// Manage env var, default, required, slices of structs take JSON arrays of objects
+	if annotations.EnvVarName != "" && val.IsZero() {
+		envValue, found := s.opts.lookupEnv(annotations.EnvVarName)
+		if found {
+			err := setValue(val, envValue, s.listFormat(annotations))
+			if err != nil {
+				return fmt.Errorf("failed to set value from environment variable: %v", err)
+			}
+			s.setSource("env:"+annotations.EnvVarName, envValue)
+			present = true
+		}
+	}
+
+	// Handle default values
+	if annotations.DefaultValue != "" && val.IsZero() && !present {
+		err := setValue(val, annotations.DefaultValue, s.listFormat(annotations))
+		if err != nil {
+			return fmt.Errorf("failed to set default value: %v", err)
+		}
+		s.setSource(SourceDefault, annotations.DefaultValue)
+	}
+
+	// Check if slice is required and empty, arrays always have their length and are empty if all elements are zero values
+	empty := val.Len() == 0
+	if val.Kind() == reflect.Array {
+		empty = val.IsZero() && !present
+	}
+	if annotations.Required && empty {
+		return fmt.Errorf("field is marked as required but has no value")
+	}
+
+	// Check if the slice contains structs, each element is processed with its own defaults and validation
+	if isStructList(val.Type()) {
 
 		// Iterate through slice elements and check each struct
 		for j := 0; j < val.Len(); j++ {
@@ -30,36 +64,12 @@ func (f *sliceField) handle(val *reflect.Value, annotations *annotations) error
 					return fmt.Errorf("failed to get field type: %v", err)
 				}
 				// Handle the field based on its type
-				err = fieldType.handle(&elementPtr, nil)
+				err = fieldType.handle(s.index(j), &elementPtr, nil)
 				if err != nil {
-					return fmt.Errorf("error in slice %s at index %d: %s", val.Type().Name(), j, err)
+					return fmt.Errorf("error in slice %s at index %d: %w", val.Type().Name(), j, err)
 				}
 			}
 		}
-	} else {
-		// Manage env var, default, required for non-struct slices
-		if annotations.EnvVarName != "" && val.IsZero() {
-			envValue, found := os.LookupEnv(annotations.EnvVarName)
-			if found {
-				err := setValue(val, envValue)
-				if err != nil {
-					return fmt.Errorf("failed to set value from environment variable: %v", err)
-				}
-			}
-		}
-
-		// Handle default values
-		if annotations.DefaultValue != "" && val.IsZero() {
-			err := setValue(val, annotations.DefaultValue)
-			if err != nil {
-				return fmt.Errorf("failed to set default value: %v", err)
-			}
-		}
-
-		// Check if slice is required and empty
-		if annotations.Required && val.Len() == 0 {
-			return fmt.Errorf("field is marked as required but has no value")
-		}
 	}
 
 	// Check for musthave fields
@@ -70,7 +80,7 @@ func (f *sliceField) handle(val *reflect.Value, annotations *annotations) error
 			if err != nil {
 				return fmt.Errorf("error comparing values: %s", err)
 			}
-			if newVal == val.Index(i) {
+			if newVal.Equal(val.Index(i)) {
 				found = true
 			}
 		}
@@ -79,7 +89,11 @@ func (f *sliceField) handle(val *reflect.Value, annotations *annotations) error
 		}
 	}
 
-	// Handle alwayshas
+	// Handle alwayshas, values can only be appended to slices
+	if len(annotations.AlwaysHas) > 0 && val.Kind() != reflect.Slice {
+		return fmt.Errorf("alwayshas annotation is not supported on fields of type %s, values can not be appended to arrays", val.Type())
+	}
+	appended := false
 	for _, alwaysHasField := range annotations.AlwaysHas {
 		found := false
 		for i := 0; i < val.Len(); i++ {
@@ -87,29 +101,26 @@ func (f *sliceField) handle(val *reflect.Value, annotations *annotations) error
 			if err != nil {
 				return fmt.Errorf("error comparing values: %s", err)
 			}
-			if newVal == val.Index(i) {
+			if newVal.Equal(val.Index(i)) {
 				found = true
-				fmt.Println("Found")
 			}
 		}
 		if !found {
 
-			// Figure out the type of the slice element
-			elemType := val.Type().Elem()
-			if elemType.Kind() == reflect.Pointer {
-				elemType = elemType.Elem()
-			}
-			newPtr := reflect.New(elemType).Elem()
-
-			newVal, err := createTypeFromValue(newPtr, alwaysHasField)
+			newVal, err := createTypeFromValue(reflect.New(val.Type().Elem()).Elem(), alwaysHasField)
 			if err != nil {
 				return fmt.Errorf("error comparing values: %s", err)
 			}
 
 			val.Set(reflect.Append(*val, newVal))
+			appended = true
 		}
 	}
 
+	if appended {
+		s.addSource(SourceAlwaysHas)
+	}
+
 	// Handle mustmatch
 	if annotations.MustMatch != nil && val.Len() > 0 {
 		for i := 0; i < val.Len(); i++ {
@@ -132,6 +143,10 @@ func (f *sliceField) handle(val *reflect.Value, annotations *annotations) error
 	if annotations.Unique && val.Len() > 0 {
 		seen := make(map[any]bool)
 		for i := 0; i < val.Len(); i++ {
+			// Values that can not be map keys, e.g. slices, would panic
+			if !val.Index(i).Comparable() {
+				return fmt.Errorf("unique annotation is not supported on values of type %s", val.Index(i).Type())
+			}
 			val := val.Index(i).Interface()
 			if seen[val] {
 				return fmt.Errorf("field value '%v' is not unique", val)
@@ -153,11 +168,26 @@ func (f *sliceField) handle(val *reflect.Value, annotations *annotations) error
 				return fmt.Errorf("intervals are only supported on integer fields")
 			}
 
+			// Zero elements of arrays are unset, e.g. padding, and are skipped as for integer fields
+			if val.Kind() == reflect.Array && val.Index(i).IsZero() {
+				continue
+			}
+
 			if !slices.Contains(interval.Values(), val.Index(i).Int()) {
 				return fmt.Errorf("integer value is out of the specified range")
 			}
 		}
 	}
 
+	// Manage named validators for each element
+	if len(annotations.Validators) > 0 {
+		for i := 0; i < val.Len(); i++ {
+			err := runValidators(val.Index(i), annotations)
+			if err != nil {
+				return fmt.Errorf("error in slice at index %d: %s", i, err)
+			}
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,59 @@
+package defcon
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds a config that is shared between goroutines and replaced atomically.
+// The zero value is an empty store, Load returns nil until a config has been stored with Swap.
+type Store[T any] struct {
+	current atomic.Pointer[T]
+	opts    []Option // Options passed to CheckStruct
+
+	mu          sync.Mutex // Serializes swaps so that subscribers see changes in order
+	subscribers []func(old, new *T)
+}
+
+// NewStore returns a store holding the given config, which is validated with CheckStruct using the given options as in Swap
+func NewStore[T any](config *T, opts ...Option) (*Store[T], error) {
+	s := &Store[T]{opts: opts}
+	err := s.Swap(config)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load returns the current config. It must be treated as read-only, as it is shared with every other caller of Load.
+func (s *Store[T]) Load() *T {
+	return s.current.Load()
+}
+
+// Swap runs CheckStruct on the new config and replaces the current config with it if it passes validation, otherwise the error is returned and the current config is kept.
+// The store takes ownership of the new config, it must not be modified after Swap. Subscribers are called with the old and new config before Swap returns.
+func (s *Store[T]) Swap(config *T) error {
+
+	err := CheckStruct(config, s.opts...)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.current.Swap(config)
+	for _, fn := range s.subscribers {
+		fn(old, config)
+	}
+
+	return nil
+}
+
+// Subscribe registers a function that is called with the old and new config whenever a config is stored.
+// Subscribers are called in order of registration and must not call Swap or Subscribe. The old config is nil for the first stored config.
+func (s *Store[T]) Subscribe(fn func(old, new *T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
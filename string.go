@@ -2,36 +2,41 @@ package defcon
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 )
 
 type stringField struct{}
 
-func (f *stringField) handle(val *reflect.Value, annotations *annotations) error {
+func (f *stringField) handle(s *state, val *reflect.Value, annotations *annotations) error {
+
+	// Tracks if the value was explicitly provided, so that zero values from environment variables are kept
+	present := false
 
 	// Lookup environment variable if specified and field is empty
 	if annotations.EnvVarName != "" && val.IsZero() {
-		envValue, found := os.LookupEnv(annotations.EnvVarName)
+		envValue, found := s.opts.lookupEnv(annotations.EnvVarName)
 		if found {
-			err := setValue(val, envValue)
+			err := setValue(val, envValue, s.listFormat(annotations))
 			if err != nil {
 				return fmt.Errorf("failed to set value from environment variable: %v", err)
 			}
+			s.setSource("env:"+annotations.EnvVarName, envValue)
+			present = true
 		}
 	}
 
 	// Mangage default value
-	if annotations.DefaultValue != "" && val.IsZero() {
-		err := setValue(val, annotations.DefaultValue)
+	if annotations.DefaultValue != "" && val.IsZero() && !present {
+		err := setValue(val, annotations.DefaultValue, s.listFormat(annotations))
 		if err != nil {
 			return fmt.Errorf("failed to set default value: %v", err)
 		}
+		s.setSource(SourceDefault, annotations.DefaultValue)
 	}
 
 	// Manage required field
 	if annotations.Required {
-		if val.IsZero() {
+		if val.IsZero() && !present {
 			return fmt.Errorf("field is marked as required but has no value")
 		}
 	}
@@ -50,5 +55,13 @@ func (f *stringField) handle(val *reflect.Value, annotations *annotations) error
 		}
 	}
 
+	// Manage named validators
+	if len(annotations.Validators) > 0 && !val.IsZero() {
+		err := runValidators(*val, annotations)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -33,10 +33,43 @@ func (f *structField) getAnnotations(v reflect.StructField) (*annotations, error
 	annotations.DefaultValue, _ = v.Tag.Lookup("default")
 	annotations.DefaultFromField, _ = v.Tag.Lookup("defaultfrom")
 
-	// Get requires fields, clean up whitespace and split by comma
+	// Get requires fields and paths, clean up whitespace and split by comma
 	requires, found := v.Tag.Lookup("requires")
 	if found {
-		annotations.RequiresField = strings.Split(strings.TrimSpace(requires), ",")
+		annotations.RequiresField = splitList(requires)
+	}
+
+	// Get excludes fields and field groups for mutual exclusion constraints
+	excludes, found := v.Tag.Lookup("excludes")
+	if found {
+		annotations.Excludes = splitList(excludes)
+	}
+	exactlyOne, found := v.Tag.Lookup("exactlyone")
+	if found {
+		annotations.ExactlyOne = splitList(exactlyOne)
+	}
+	atLeastOne, found := v.Tag.Lookup("atleastone")
+	if found {
+		annotations.AtLeastOne = splitList(atLeastOne)
+	}
+	atMostOne, found := v.Tag.Lookup("atmostone")
+	if found {
+		annotations.AtMostOne = splitList(atMostOne)
+	}
+
+	// Get fields referenced by comparison annotations, these are resolved in the struct level pass
+	for tag, target := range map[string]*string{
+		"ltfield":  &annotations.LtField,
+		"ltefield": &annotations.LteField,
+		"gtfield":  &annotations.GtField,
+		"gtefield": &annotations.GteField,
+		"eqfield":  &annotations.EqField,
+		"nefield":  &annotations.NeField,
+	} {
+		other, found := v.Tag.Lookup(tag)
+		if found {
+			*target = strings.TrimSpace(other)
+		}
 	}
 
 	// Get and clean up environment variable names
@@ -45,10 +78,34 @@ func (f *structField) getAnnotations(v reflect.StructField) (*annotations, error
 		annotations.EnvVarName = strings.TrimSpace(envVar)
 	}
 
-	// Get and clean up musthave values
+	// Get the separator of list values, musthave and alwayshas are split with it
+	sep, found := v.Tag.Lookup("sep")
+	if found {
+		if sep == "" {
+			return nil, fmt.Errorf("sep must not be empty")
+		}
+		annotations.Sep = sep
+	}
+
+	// Get the discriminator key selecting the concrete type of interface fields
+	oneOfType, found := v.Tag.Lookup("oneoftype")
+	if found {
+		annotations.OneOfType = strings.TrimSpace(oneOfType)
+		if v.Type.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("oneoftype is only supported on interface fields")
+		}
+		if annotations.OneOfType == "" {
+			return nil, fmt.Errorf("oneoftype must not be empty")
+		}
+	}
+
+	// Get musthave values
 	mustHave, found := v.Tag.Lookup("musthave")
 	if found {
-		annotations.MustHave = strings.Split(strings.TrimSpace(mustHave), ",")
+		annotations.MustHave, err = ParseList(mustHave, annotations.Sep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid musthave values: %s", err)
+		}
 	}
 
 	// Get and validate boolean value for unique
@@ -61,10 +118,13 @@ func (f *structField) getAnnotations(v reflect.StructField) (*annotations, error
 		annotations.Unique = uniqueBool
 	}
 
-	// Get and cleanup values for alwayshas
+	// Get alwayshas values
 	alwaysHas, found := v.Tag.Lookup("alwayshas")
 	if found {
-		annotations.AlwaysHas = strings.Split(strings.TrimSpace(alwaysHas), ",")
+		annotations.AlwaysHas, err = ParseList(alwaysHas, annotations.Sep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alwayshas values: %s", err)
+		}
 	}
 
 	// Get and compile regex for mustmatch
@@ -100,6 +160,58 @@ func (f *structField) getAnnotations(v reflect.StructField) (*annotations, error
 	if found {
 		annotations.ValidRange = validRange
 	}
+
+	// Get named validators, these must be registered before the struct is checked
+	validate, found := v.Tag.Lookup("validate")
+	if found {
+		annotations.Validators, err = parseValidators(validate, v.Type)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get assertion expression, this is compiled and evaluated in the struct level pass
+	assert, found := v.Tag.Lookup("assert")
+	if found {
+		annotations.Assert = strings.TrimSpace(assert)
+	}
+
+	// Get and validate boolean value for secret
+	secret, found := v.Tag.Lookup("secret")
+	if found {
+		secretBool, err := strconv.ParseBool(secret)
+		if err != nil {
+			return nil, fmt.Errorf("non-boolean value found where expected: %s", err)
+		}
+		annotations.Secret = secretBool
+	}
+
+	// Description is a pure string value used for documentation, no checks required
+	annotations.Desc, _ = v.Tag.Lookup("desc")
+
+	// Get and validate options of the field itself, inline promotes the fields of a struct to the containing struct and - skips the field
+	option, found := v.Tag.Lookup("defcon")
+	if found {
+		switch strings.TrimSpace(option) {
+		case "inline", "squash":
+			if v.Type.Kind() != reflect.Struct || isOptional(v.Type) {
+				return nil, fmt.Errorf("defcon:\"%s\" is only supported on struct fields", option)
+			}
+		case "-":
+		default:
+			return nil, fmt.Errorf("defcon must be inline, squash or -, got %s", option)
+		}
+	}
+
+	// Get and validate the reload classification used by Diff
+	reload, found := v.Tag.Lookup("reload")
+	if found {
+		annotations.Reload = strings.TrimSpace(reload)
+		if annotations.Reload != ReloadLive && annotations.Reload != ReloadRestart {
+			return nil, fmt.Errorf("reload must be %s or %s, got %s", ReloadLive, ReloadRestart, reload)
+		}
+	}
+
 	errMsg, found := v.Tag.Lookup("errormsg")
 	if found {
 		annotations.ErrorMsg = errMsg
@@ -108,20 +220,323 @@ func (f *structField) getAnnotations(v reflect.StructField) (*annotations, error
 	return &annotations, nil
 }
 
-func (f *structField) handle(val *reflect.Value, annotations *annotations) error {
+// splitList splits a comma separated annotation value and trims whitespace from each element
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// isInline returns true if the fields of a struct field are promoted to the containing struct, as for embedded structs and fields tagged `defcon:"inline"` or `defcon:"squash"`.
+// Promoted fields can be referenced by name from the containing struct and their paths do not include the name of the inline field.
+func isInline(sf reflect.StructField) bool {
+	if sf.Type.Kind() != reflect.Struct || isOptional(sf.Type) || isOpaque(sf.Type) || isSkipped(sf) {
+		return false
+	}
+	if sf.Anonymous {
+		return true
+	}
+	option := strings.TrimSpace(sf.Tag.Get("defcon"))
+	return option == "inline" || option == "squash"
+}
+
+// isSkipped returns true for fields tagged `defcon:"-"`, which are left untouched together with any nested fields
+func isSkipped(sf reflect.StructField) bool {
+	return strings.TrimSpace(sf.Tag.Get("defcon")) == "-"
+}
+
+// fieldByName returns the field of a struct type with the given name, including fields promoted from inline structs, with the index sequence from the struct.
+// As for embedded fields in Go, shallower fields take precedence and names that are ambiguous at the same depth are not found.
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+
+	type candidate struct {
+		t     reflect.Type
+		index []int
+	}
+
+	level := []candidate{{t: t}}
+	for len(level) > 0 {
+		found := []reflect.StructField{}
+		next := []candidate{}
+		for _, c := range level {
+			for i := 0; i < c.t.NumField(); i++ {
+				sf := c.t.Field(i)
+				index := append(slices.Clone(c.index), i)
+				if sf.Name == name {
+					sf.Index = index
+					found = append(found, sf)
+				}
+				if isInline(sf) {
+					next = append(next, candidate{t: sf.Type, index: index})
+				}
+			}
+		}
+		switch len(found) {
+		case 0:
+			level = next
+		case 1:
+			return found[0], true
+		default:
+			return reflect.StructField{}, false
+		}
+	}
+
+	return reflect.StructField{}, false
+}
 
-	// Check which fields are set in the struct and store them for validation of "requires" tags
+// getSetFields returns the names of all fields in the struct that are set, i.e. not set to their zero value or explicitly provided by an environment variable.
+// Fields promoted from inline structs are included unless a field of the same name is declared by the struct itself.
+func getSetFields(s *state, val *reflect.Value) []string {
 	setFields := []string{}
+	promoted := []string{}
 	for i := 0; i < val.NumField(); i++ {
 		v := val.Field(i)
-		name := val.Type().Field(i).Name
-		if !v.IsZero() {
+		sf := val.Type().Field(i)
+		if isInline(sf) {
+			promoted = append(promoted, getSetFields(s, &v)...)
+		}
+		if isSet(s, sf, v) {
+			setFields = append(setFields, sf.Name)
+		}
+	}
+	for _, name := range promoted {
+		if sf, found := fieldByName(val.Type(), name); found && len(sf.Index) > 1 && !slices.Contains(setFields, name) {
 			setFields = append(setFields, name)
 		}
 	}
+	return setFields
+}
+
+// isSet returns true if a field is set, i.e. not set to its zero value or explicitly provided by an environment variable
+func isSet(s *state, sf reflect.StructField, v reflect.Value) bool {
+	if !v.IsZero() {
+		return true
+	}
+	// A zero value is still considered set if it is provided by an environment variable
+	envVar, found := sf.Tag.Lookup("env")
+	if found {
+		if _, found := s.opts.lookupEnv(strings.TrimSpace(envVar)); found {
+			return true
+		}
+	}
+	return false
+}
+
+// isPathSet returns true if the field at a path referenced by a "requires" annotation is set, together with the path of the field from the root struct.
+// Paths without leading dots, e.g. "Database.Host" or "Hostname", are absolute from the root struct. Paths starting with dots are relative, "." being the struct of the annotated field,
+// ".." its parent and so on, e.g. "..TLS.CertFile". Fields of inline structs are resolved as promoted fields.
+func (s *state) isPathSet(path string) (bool, string, error) {
+
+	// Count the leading dots to find the struct the path starts from
+	rest := strings.TrimLeft(path, ".")
+	base := s.scopes[0]
+	if dots := len(path) - len(rest); dots > 0 {
+		if dots > len(s.scopes) {
+			return false, "", fmt.Errorf("path %s goes above the root struct", path)
+		}
+		base = s.scopes[len(s.scopes)-dots]
+	}
+
+	parentPath, name := "", rest
+	if idx := strings.LastIndex(rest, "."); idx >= 0 {
+		parentPath, name = rest[:idx], rest[idx+1:]
+	}
+	parent := base.val
+	if parentPath != "" {
+		var err error
+		parent, err = lookupField(base.val, parentPath)
+		if err != nil {
+			return false, "", err
+		}
+	}
+	if !token.IsIdentifier(name) {
+		return false, "", fmt.Errorf("field %s does not seem to have a valid name", path)
+	}
+	if parent.Kind() != reflect.Struct {
+		return false, "", fmt.Errorf("field %s can not be resolved, %s is not a struct", path, parent.Type())
+	}
+	sf, found := fieldByName(parent.Type(), name)
+	if !found {
+		return false, "", fmt.Errorf("field %s does not exist", path)
+	}
+
+	fullPath := rest
+	if base.path != "" {
+		fullPath = base.path + "." + rest
+	}
+
+	return isSet(s, sf, parent.FieldByIndex(sf.Index)), fullPath, nil
+}
+
+// checkRequires validates that the fields referenced by the "requires" tag of a struct field are set if the field itself is set
+func checkRequires(s *state, val reflect.Value, i int, annotations *annotations) error {
+
+	name := val.Type().Field(i).Name
+	if val.Field(i).IsZero() {
+		return nil
+	}
+
+	for _, requiredField := range annotations.RequiresField {
+
+		// Fields of the same struct are looked up by name, other names and paths are resolved against the whole config
+		var set bool
+		var err error
+		requiredPath := ""
+		if sf, found := fieldByName(val.Type(), requiredField); found && token.IsIdentifier(requiredField) {
+			set = isSet(s, sf, val.FieldByIndex(sf.Index))
+		} else {
+			set, requiredPath, err = s.isPathSet(requiredField)
+			if err != nil {
+				return fmt.Errorf("field %s tagged as required by field %s: %s", requiredField, name, err)
+			}
+		}
+		if !set {
+			// Use custom error message if provided in the annotations
+			if annotations.ErrorMsg != "" {
+				return fmt.Errorf("%s", annotations.ErrorMsg)
+			}
+			if requiredPath == "" {
+				requiredPath = s.field(requiredField).path
+			}
+			return fmt.Errorf("field %s requires field %s to be set", s.field(name).path, requiredPath)
+		}
+	}
+
+	return nil
+}
+
+// checkGroups validates the mutual exclusion and group constraints declared on a struct field
+func checkGroups(t reflect.Type, fieldName string, setFields []string, annotations *annotations) error {
+
+	// Referenced fields must exist in the struct, a misspelled name would never count as set
+	for _, group := range [][]string{annotations.Excludes, annotations.ExactlyOne, annotations.AtLeastOne, annotations.AtMostOne} {
+		for _, name := range group {
+			if _, found := fieldByName(t, name); !found {
+				return fmt.Errorf("field %s referenced by field %s does not exist", name, fieldName)
+			}
+		}
+	}
+
+	// Excluded fields can not be set at the same time as the annotated field
+	if slices.Contains(setFields, fieldName) {
+		for _, excluded := range annotations.Excludes {
+			if slices.Contains(setFields, excluded) {
+				return fmt.Errorf("field %s excludes field %s, but both are set", fieldName, excluded)
+			}
+		}
+	}
+
+	// Count how many fields in a group are set
+	count := func(group []string) int {
+		n := 0
+		for _, name := range group {
+			if slices.Contains(setFields, name) {
+				n++
+			}
+		}
+		return n
+	}
+
+	if len(annotations.ExactlyOne) > 0 {
+		if n := count(annotations.ExactlyOne); n != 1 {
+			return fmt.Errorf("exactly one of fields %s must be set, but %d are set", strings.Join(annotations.ExactlyOne, ", "), n)
+		}
+	}
+	if len(annotations.AtLeastOne) > 0 {
+		if count(annotations.AtLeastOne) == 0 {
+			return fmt.Errorf("at least one of fields %s must be set", strings.Join(annotations.AtLeastOne, ", "))
+		}
+	}
+	if len(annotations.AtMostOne) > 0 {
+		if n := count(annotations.AtMostOne); n > 1 {
+			return fmt.Errorf("at most one of fields %s may be set, but %d are set", strings.Join(annotations.AtMostOne, ", "), n)
+		}
+	}
+
+	return nil
+}
+
+// setDefaultFrom sets the value of an unset field from another field in the same struct, values from environment variables take precedence.
+// Optional fields are unwrapped on both sides, an unset Optional is neither overwritten nor taken as a default.
+func (f *structField) setDefaultFrom(s *state, val *reflect.Value, subField *reflect.Value, annotations *annotations) error {
+
+	target, present := unwrapOptional(*subField)
+	if present {
+		return nil
+	}
+	if annotations.EnvVarName != "" {
+		if _, found := s.opts.lookupEnv(annotations.EnvVarName); found {
+			return nil
+		}
+	}
+
+	from, err := lookupField(*val, annotations.DefaultFromField)
+	if err != nil {
+		return fmt.Errorf("field %s referenced by defaultfrom: %s", annotations.DefaultFromField, err)
+	}
+	fromValue, fromSet := unwrapOptional(from)
+	if !fromValue.Type().AssignableTo(target.Type()) {
+		return fmt.Errorf("field of type %s can not take its default from field %s of type %s", subField.Type(), annotations.DefaultFromField, from.Type())
+	}
+	if !fromSet {
+		return nil
+	}
+
+	target.Set(fromValue)
+	if isOptional(subField.Type()) {
+		subField.Addr().Interface().(optional).markPresent()
+	}
+	s.setSource("defaultfrom:"+annotations.DefaultFromField, "")
+
+	return nil
+}
+
+// isUnexported returns true for unexported fields, which are left untouched with WithSkipUnexported.
+// Embedded structs of unexported types are not, as the exported fields promoted from them are accessible.
+func isUnexported(sf reflect.StructField) bool {
+	return !sf.IsExported() && !(sf.Anonymous && isInline(sf))
+}
+
+// fieldOrder returns the indices of the fields of a struct in the order they are processed. Fields annotated with "defaultfrom" are processed after
+// all other fields, in the order they are declared, so that they take their default from fields which have their own defaults and environment variables applied.
+func fieldOrder(t reflect.Type) []int {
+	order := make([]int, 0, t.NumField())
+	deferred := []int{}
+	for i := 0; i < t.NumField(); i++ {
+		if _, found := t.Field(i).Tag.Lookup("defaultfrom"); found {
+			deferred = append(deferred, i)
+			continue
+		}
+		order = append(order, i)
+	}
+	return append(order, deferred...)
+}
+
+func (f *structField) handle(s *state, val *reflect.Value, annotations *annotations) error {
+
+	// Enter the scope of the struct for paths in "requires", inline structs share the scope of the containing struct
+	if !s.inline {
+		s = &state{path: s.path, opts: s.opts, source: s.source, scopes: append(slices.Clip(s.scopes), scope{val: *val, path: s.path}), secret: s.secret}
+	}
+
+	// Let the struct set its own defaults before any annotations are processed
+	callDefaulter(val)
+
+	// Fields carrying group constraints or comparisons, these are validated once all fields are processed
+	deferredFields := []int{}
 
 	// Iterate struct fields and handle each field recursively
-	for i := 0; i < val.NumField(); i++ {
+	for _, i := range fieldOrder(val.Type()) {
+
+		// Skip fields excluded by their tag or the options
+		if isSkipped(val.Type().Field(i)) || (s.opts.skipUnexported && isUnexported(val.Type().Field(i))) {
+			continue
+		}
 
 		var subField reflect.Value
 		v := val.Field(i)
@@ -145,27 +560,37 @@ func (f *structField) handle(val *reflect.Value, annotations *annotations) error
 			return fmt.Errorf("invalid annotation syntax: %s", err)
 		}
 
-		// Check if the field has a "requires" tag and validate that it is set if the current field is set
-		// This needs to be handled on the struct level because the "requires" tag can reference other fields in the same struct
-		if len(annotations.RequiresField) > 0 && !subField.IsZero() {
+		// Fields referenced by a "requires" tag are checked once the whole config has been processed, so that their defaults and environment variables are applied
+		// regardless of the order in which the fields are declared
+		if len(annotations.RequiresField) > 0 {
+			s.opts.requires = append(s.opts.requires, func() error {
+				return checkRequires(s, *val, i, annotations)
+			})
+		}
 
-			for _, requiredField := range annotations.RequiresField {
+		// Record the provenance of leaf fields if a report is requested, fields of inline structs have the path of the containing struct
+		fieldState := s.field(val.Type().Field(i).Name)
+		if isInline(val.Type().Field(i)) {
+			fieldState = &state{path: s.path, opts: s.opts, scopes: s.scopes, inline: true}
+		}
+		fieldState.secret = s.secret || annotations.Secret
+		if s.opts.report != nil && isLeaf(subField) {
+			fieldState.source = &FieldSource{Path: fieldState.path, Source: SourceUnset}
+			if !subField.IsZero() {
+				fieldState.source.Source = SourcePreset
+			}
+		}
 
-				if !token.IsIdentifier(requiredField) {
-					return fmt.Errorf("field %s tagged as required by field %s does not seem to have a valid name", requiredField, val.Type().Field(i).Name)
-				}
-				if !slices.Contains(setFields, requiredField) { // Check if the required field is set
-					// Use custom error message if provided in the annotations
-					if annotations.ErrorMsg != "" {
-						return fmt.Errorf("%s", annotations.ErrorMsg)
-					}
-					return fmt.Errorf("field %s requires field %s to be set", val.Type().Field(i).Name, requiredField)
-				}
+		// Manage defaultfrom, this needs to be handled on the struct level because it references other fields in the same struct
+		if annotations.DefaultFromField != "" {
+			err = f.setDefaultFrom(fieldState, val, &subField, annotations)
+			if err != nil {
+				return err
 			}
 		}
 
 		// Handle the field based on its type
-		err = fieldType.handle(&subField, annotations)
+		err = fieldType.handle(fieldState, &subField, annotations)
 		if err != nil {
 			// Use custom error message if provided in the annotations
 			if annotations.ErrorMsg != "" {
@@ -173,6 +598,62 @@ func (f *structField) handle(val *reflect.Value, annotations *annotations) error
 			}
 			return err
 		}
+
+		if fieldState.source != nil {
+			fieldState.source.Value = reportValue(subField)
+			if fieldState.secret || (!subField.IsZero() && containsSecrets(subField)) {
+				// Secrets, and values holding secrets of nested fields, are redacted as in Dump, the source is kept
+				fieldState.source.Value = Redacted
+				if fieldState.source.Raw != "" {
+					fieldState.source.Raw = Redacted
+				}
+			}
+			s.opts.report.Fields = append(s.opts.report.Fields, *fieldState.source)
+		}
+
+		if annotations.hasStructChecks() {
+			deferredFields = append(deferredFields, i)
+		}
+	}
+
+	// Validate group constraints and comparisons after env and default values have been applied, in the order the fields are declared
+	if len(deferredFields) > 0 {
+		slices.Sort(deferredFields)
+		setFields := getSetFields(s, val)
+		for _, i := range deferredFields {
+			annotations, err := f.getAnnotations(val.Type().Field(i))
+			if err != nil {
+				return fmt.Errorf("invalid annotation syntax: %s", err)
+			}
+			err = checkGroups(val.Type(), val.Type().Field(i).Name, setFields, annotations)
+			if err == nil {
+				err = checkComparisons(val, val.Type().Field(i).Name, annotations)
+			}
+			if err == nil && annotations.Assert != "" {
+				err = checkAssert(val, annotations.Assert)
+			}
+			if err != nil {
+				// Use custom error message if provided in the annotations
+				if annotations.ErrorMsg != "" {
+					return fmt.Errorf("%s", annotations.ErrorMsg)
+				}
+				return err
+			}
+		}
+	}
+
+	// Manage named validators on the struct itself, the root struct and slice elements have no annotations
+	if annotations != nil && len(annotations.Validators) > 0 && !val.IsZero() {
+		err := runValidators(*val, annotations)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Let the struct validate itself once all fields are processed
+	err := callValidator(s, val)
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -1,8 +1,10 @@
 package defcon
 
 import (
+	"fmt"
 	"reflect"
 	"regexp"
+	"time"
 )
 
 // struct field annotations
@@ -10,7 +12,17 @@ type annotations struct {
 	Required         bool           // Indicates if the field is required
 	DefaultValue     string         // Default value for the field if not set
 	DefaultFromField string         // Specifies another field from which to derive the default value
-	RequiresField    []string       // Specifies another field that must be set if this field is set
+	RequiresField    []string       // Specifies other fields, by name or path, that must be set if this field is set
+	Excludes         []string       // Specifies fields that must not be set if this field is set
+	ExactlyOne       []string       // Specifies a group of fields of which exactly one must be set
+	AtLeastOne       []string       // Specifies a group of fields of which at least one must be set
+	AtMostOne        []string       // Specifies a group of fields of which at most one may be set
+	LtField          string         // Specifies a field that this field must be less than
+	LteField         string         // Specifies a field that this field must be less than or equal to
+	GtField          string         // Specifies a field that this field must be greater than
+	GteField         string         // Specifies a field that this field must be greater than or equal to
+	EqField          string         // Specifies a field that this field must be equal to
+	NeField          string         // Specifies a field that this field must not be equal to
 	EnvVarName       string         // Name of the environment variable to use for this field
 	Unique           bool           // Indicates if the field values must be unique in a slice
 	OneOf            string         // Specifies a set of allowed values for the field
@@ -18,17 +30,105 @@ type annotations struct {
 	MustNotMatch     *regexp.Regexp // Specifies a regex pattern that the field value must not match
 	MustHave         []string       // Specifies a list of fields that must be present in a slice
 	AlwaysHas        []string       // Specifies a list of fields that will always be present in a slice, even if not set
+	Sep              string         // Separator of list values in defaults, environment variables, musthave and alwayshas, commas and newlines if empty
+	OneOfType        string         // Discriminator key of JSON objects selecting the concrete type of an interface field
 	ValidRange       string         // Specifies a range of allowed values for the field (e.g., "1-10, 44, 100-200")
+	Validators       []validatorRef // Specifies named validators to run against the field value
+	Assert           string         // Specifies an expression that must evaluate to true for the containing struct
+	Secret           bool           // Indicates that the field value must be redacted when printed
+	Desc             string         // Description of the field, used in generated documentation
+	Reload           string         // Whether changes of the field can be applied live or require a restart, used by Diff
 	ErrorMsg         string         // Custom error message to use when validation fails
 }
 
+// annotationKeys lists all struct tag keys used by defcon, in the order they are presented
+var annotationKeys = []string{
+	"required", "default", "defaultfrom", "env", "requires", "excludes", "exactlyone", "atleastone", "atmostone",
+	"ltfield", "ltefield", "gtfield", "gtefield", "eqfield", "nefield", "musthave", "unique", "alwayshas",
+	"sep", "oneoftype", "mustmatch", "mustnotmatch", "validrange", "validate", "assert", "secret", "desc", "reload", "defcon", "errormsg",
+}
+
+// hasStructChecks returns true if the annotations contain checks that must be evaluated on the struct level after all fields are processed
+func (a *annotations) hasStructChecks() bool {
+	return len(a.Excludes) > 0 || len(a.ExactlyOne) > 0 || len(a.AtLeastOne) > 0 || len(a.AtMostOne) > 0 ||
+		a.LtField != "" || a.LteField != "" || a.GtField != "" || a.GteField != "" || a.EqField != "" || a.NeField != "" || a.Assert != ""
+}
+
+// state carried through the recursion of a single CheckStruct call
+type state struct {
+	path   string       // Path of the current field from the root struct, e.g. "Backends[0].Host"
+	opts   *options     // Options given to CheckStruct
+	source *FieldSource // Provenance of the current field, nil if no report is requested or the field is not a leaf
+	scopes []scope      // Structs enclosing the current field, starting with the root struct, for resolving paths in "requires"
+	inline bool         // True if the current field is an inline struct, its fields belong to the scope of the containing struct
+	secret bool         // True if the current field or a struct enclosing it is annotated with secret:"true", its value is redacted in reports
+}
+
+// scope is a struct enclosing the current field
+type scope struct {
+	val  reflect.Value
+	path string
+}
+
+// listFormat describes how list values of defaults and environment variables are parsed into slices and arrays
+type listFormat struct {
+	sep string // Separator given by the "sep" annotation, commas and newlines if empty
+	pad bool   // Arrays may be given fewer elements than their length, the rest are left at their zero value
+}
+
+// listFormat returns the format of list values for a field with the given annotations
+func (s *state) listFormat(annotations *annotations) listFormat {
+	return listFormat{sep: annotations.Sep, pad: s.opts.padArrays}
+}
+
+// field returns the state for a named field of the current struct
+func (s *state) field(name string) *state {
+	if s.path == "" {
+		return &state{path: name, opts: s.opts, scopes: s.scopes, secret: s.secret}
+	}
+	return &state{path: s.path + "." + name, opts: s.opts, scopes: s.scopes, secret: s.secret}
+}
+
+// index returns the state for an element of the current slice
+func (s *state) index(i int) *state {
+	return &state{path: fmt.Sprintf("%s[%d]", s.path, i), opts: s.opts, scopes: s.scopes, secret: s.secret}
+}
+
+// setSource records the source and raw value of the current field
+func (s *state) setSource(source, raw string) {
+	if s.source != nil {
+		s.source.Source = source
+		s.source.Raw = raw
+	}
+}
+
+// addSource records an additional source for the current field, e.g. values appended by "alwayshas"
+func (s *state) addSource(source string) {
+	if s.source == nil {
+		return
+	}
+	if s.source.Source == SourceUnset {
+		s.source.Source = source
+	} else {
+		s.source.Source += "+" + source
+	}
+}
+
 // common interface for all field types
 type field interface {
-	handle(*reflect.Value, *annotations) error
+	handle(*state, *reflect.Value, *annotations) error
 }
 
 // getType returns the appropriate field type based on the reflect.Value kind
 func getType(v reflect.Value) (field, error) {
+	// Optional values are structs but are handled as the type they wrap
+	if isOptional(v.Type()) && v.CanAddr() {
+		return &optionalField{}, nil
+	}
+	// Opaque structs are handled as a whole, their fields are internal state
+	if isOpaque(v.Type()) {
+		return &otherField{}, nil
+	}
 	switch v.Kind() {
 	case reflect.String:
 		return &stringField{}, nil
@@ -42,7 +142,32 @@ func getType(v reflect.Value) (field, error) {
 		return &boolField{}, nil
 	case reflect.Slice, reflect.Array:
 		return &sliceField{}, nil
+	case reflect.Interface:
+		return &interfaceField{}, nil
 	default:
-		return nil, nil
+		return &otherField{}, nil
 	}
 }
+
+// isStructList returns true for slices and arrays of structs, their elements are processed as nested structs
+func isStructList(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && isNestedStruct(t.Elem())
+}
+
+// derefType returns the element type of pointer types
+func derefType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// isNestedStruct returns true for struct types whose fields are walked, i.e. structs other than Optional and opaque types
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !isOptional(t) && !isOpaque(t)
+}
+
+// isOpaque returns true for struct types that are never descended into, as their fields are internal state, e.g. time.Time, sync.Mutex and atomic.Int64
+func isOpaque(t reflect.Type) bool {
+	return t == reflect.TypeFor[time.Time]() || t.PkgPath() == "sync" || t.PkgPath() == "sync/atomic"
+}
@@ -0,0 +1,101 @@
+package defcon
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ValidatorFunc validates a field value, param holds the parameter given in the annotation, e.g. "prod" for `validate:"tenant=prod"`
+type ValidatorFunc func(v reflect.Value, param string) error
+
+// Registry of named validators usable in the "validate" annotation
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]validator{}
+)
+
+// validator is a registered validator and the kinds of values it accepts
+type validator struct {
+	fn    ValidatorFunc
+	kinds []reflect.Kind // Kinds of values the validator accepts, any kind if empty
+}
+
+// validatorRef is a reference to a named validator and its parameter, parsed from the "validate" annotation
+type validatorRef struct {
+	name  string
+	param string
+}
+
+// RegisterValidator registers a named validator for use in the "validate" annotation.
+// The name must be a valid identifier and not already registered. The kinds of values the validator accepts can be given, e.g. reflect.String,
+// fields of other kinds referencing the validator are rejected by CheckStruct before the validator is run. Validators without kinds accept any value.
+func RegisterValidator(name string, fn ValidatorFunc, kinds ...reflect.Kind) error {
+
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("validator name %s is not a valid identifier", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("validator %s has no function", name)
+	}
+
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+
+	if _, found := validators[name]; found {
+		return fmt.Errorf("validator %s is already registered", name)
+	}
+	validators[name] = validator{fn: fn, kinds: kinds}
+
+	return nil
+}
+
+// parseValidators parses a "validate" annotation, e.g. "region, tenant=prod", and checks that all validators are registered and accept values of the field's type
+func parseValidators(s string, t reflect.Type) ([]validatorRef, error) {
+
+	// Optional fields are validated by their wrapped value and slices and arrays per element
+	t = valueType(t)
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+
+	refs := []validatorRef{}
+
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+
+	for _, item := range splitList(s) {
+		name, param, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		v, found := validators[name]
+		if !found {
+			return nil, fmt.Errorf("validator %s is not registered", name)
+		}
+		if len(v.kinds) > 0 && !slices.Contains(v.kinds, t.Kind()) {
+			return nil, fmt.Errorf("validator %s does not accept values of type %s", name, t)
+		}
+		refs = append(refs, validatorRef{name: name, param: strings.TrimSpace(param)})
+	}
+
+	return refs, nil
+}
+
+// runValidators runs all validators referenced in the annotations against the value
+func runValidators(val reflect.Value, annotations *annotations) error {
+
+	for _, ref := range annotations.Validators {
+		validatorsMu.RLock()
+		v := validators[ref.name]
+		validatorsMu.RUnlock()
+
+		err := v.fn(val, ref.param)
+		if err != nil {
+			return fmt.Errorf("validator %s failed: %s", ref.name, err)
+		}
+	}
+
+	return nil
+}
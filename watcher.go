@@ -0,0 +1,238 @@
+package defcon
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Watcher reloads a config struct when its sources change. Config files are polled for changes in modification time and content,
+// environment variables used by the last reload are looked up again with the lookup given by WithLookupEnv.
+// Every reload decodes the files into a fresh struct and runs CheckStruct on it, only configs that pass are published to subscribers.
+type Watcher[T any] struct {
+	files []string
+	opts  []Option // Options passed to CheckStruct
+	o     *options
+
+	mu          sync.Mutex
+	config      *T                   // Last config that passed validation
+	fileStates  map[string]fileState // State of the files at the last reload
+	envValues   map[string]envValue  // Environment variables looked up during the last reload
+	subscribers []chan *T
+	errors      chan error
+}
+
+// fileState is the state of a config file at the time it was read
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// envValue is the result of looking up an environment variable
+type envValue struct {
+	value string
+	found bool
+}
+
+// NewWatcher loads the config from the given files, decoded in order on top of each other, and environment variables.
+// An error is returned if the polling interval is not positive, or if the initial config can not be loaded or does not pass validation.
+// Call Watch to start polling for changes.
+func NewWatcher[T any](files []string, opts ...Option) (*Watcher[T], error) {
+
+	w := &Watcher[T]{
+		files:  files,
+		opts:   opts,
+		o:      newOptions(opts),
+		errors: make(chan error, 1),
+	}
+	if w.o.interval <= 0 {
+		return nil, fmt.Errorf("polling interval must be positive, got %s", w.o.interval)
+	}
+
+	err := w.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Config returns the last config that passed validation. Every reload creates a new struct, a returned config is never modified by the Watcher.
+func (w *Watcher[T]) Config() *T {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.config
+}
+
+// Subscribe returns a channel receiving every new config that passes validation.
+// Only the latest config is kept if the channel is not drained.
+func (w *Watcher[T]) Subscribe() <-chan *T {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ch := make(chan *T, 1)
+	w.subscribers = append(w.subscribers, ch)
+	return ch
+}
+
+// Errors returns a channel receiving errors of reloads started by Watch, the last good config is kept when a reload fails.
+// Only the latest error is kept if the channel is not drained.
+func (w *Watcher[T]) Errors() <-chan error {
+	return w.errors
+}
+
+// Watch polls the sources for changes at the interval given by WithInterval and reloads the config when they change, until the context is done
+func (w *Watcher[T]) Watch(ctx context.Context) {
+
+	ticker := time.NewTicker(w.o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !w.changed() {
+				continue
+			}
+			err := w.Reload()
+			if err != nil {
+				publish(w.errors, err)
+			}
+		}
+	}
+}
+
+// Reload loads the config from its sources and publishes it to subscribers if it passes validation, otherwise the error is returned and the last good config is kept
+func (w *Watcher[T]) Reload() error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	config := new(T)
+
+	// Record the state of the sources as they are read, so that a failed reload is not retried until they change again
+	w.fileStates = map[string]fileState{}
+	w.envValues = map[string]envValue{}
+
+	for _, file := range w.files {
+		state, err := decodeFile(file, config, w.o)
+		w.fileStates[file] = state
+		if err != nil {
+			return err
+		}
+	}
+
+	// Record every environment variable the config depends on
+	recordEnv := WithLookupEnv(func(key string) (string, bool) {
+		value, found := w.o.lookupEnv(key)
+		w.envValues[key] = envValue{value: value, found: found}
+		return value, found
+	})
+	err := CheckStruct(config, append(w.opts[:len(w.opts):len(w.opts)], recordEnv)...)
+	if err != nil {
+		return err
+	}
+
+	w.config = config
+	for _, ch := range w.subscribers {
+		publish(ch, config)
+	}
+
+	return nil
+}
+
+// changed returns true if any file or environment variable has changed since the last reload
+func (w *Watcher[T]) changed() bool {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, file := range w.files {
+		last := w.fileStates[file]
+		info, err := os.Stat(file)
+		if err != nil {
+			if last.exists {
+				return true
+			}
+			continue
+		}
+		if !last.exists {
+			return true
+		}
+		if info.ModTime().Equal(last.modTime) && info.Size() == last.size {
+			continue
+		}
+		// The modification time changed, compare the content to skip reloads of files that were only touched
+		_, state, err := readFile(file)
+		if err != nil || state.hash != last.hash {
+			return true
+		}
+		w.fileStates[file] = state
+	}
+
+	for key, last := range w.envValues {
+		value, found := w.o.lookupEnv(key)
+		if value != last.value || found != last.found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeFile decodes a config file on top of the config and returns the state of the file as it was read
+func decodeFile(file string, config any, o *options) (fileState, error) {
+	data, state, err := readFile(file)
+	if err != nil {
+		return state, fmt.Errorf("failed to read config file %s: %w", file, err)
+	}
+
+	// Allocate the types selected by discriminators in the file, so that they are decoded into
+	var raw any
+	if v := reflect.ValueOf(config).Elem(); v.Kind() == reflect.Struct && o.decode(data, &raw) == nil {
+		err = allocateOneOf(v, raw)
+		if err != nil {
+			return state, fmt.Errorf("failed to decode config file %s: %w", file, err)
+		}
+	}
+
+	err = o.decode(data, config)
+	if err != nil {
+		return state, fmt.Errorf("failed to decode config file %s: %w", file, err)
+	}
+	return state, nil
+}
+
+// readFile reads a file and returns its content together with its state
+func readFile(file string) ([]byte, fileState, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fileState{}, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fileState{}, err
+	}
+	return data, fileState{exists: true, modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(data)}, nil
+}
+
+// publish sends a value on a channel with a buffer of one, replacing any value that has not been received
+func publish[V any](ch chan V, v V) {
+	for {
+		select {
+		case ch <- v:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}